@@ -0,0 +1,246 @@
+// Package emulator emulates the Hack computer built in 05/Computer.hdl.
+package emulator
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+const (
+	ROMSize = 1 << 15
+	RAMSize = 1 << 15
+
+	Screen     = 16384 // first word of the memory-mapped screen
+	ScreenSize = 8192
+	Keyboard   = 24576 // memory-mapped keyboard register
+)
+
+// Computer is a Hack CPU with its ROM and data memory.
+//
+// RAM is the whole 15-bit data address space: RAM[0..16383] is general
+// purpose, RAM[Screen..Screen+ScreenSize-1] is the screen and RAM[Keyboard]
+// the keyboard. Writes by the program to Keyboard are ignored, as in
+// Memory.hdl; the host sets it with SetKey or a KeyScript.
+type Computer struct {
+	ROM [ROMSize]uint16
+	RAM [RAMSize]uint16
+
+	A  uint16
+	D  uint16
+	PC uint16
+
+	Cycles uint64
+
+	// Keys, if set, holds the keyboard register for every cycle.
+	Keys *KeyScript
+
+	halted bool
+
+	// the state at the last backward jump, see Step
+	loopFrom    uint16
+	loopA       uint16
+	loopD       uint16
+	loopWrites  []loopWrite
+	loopStarted bool
+	loopChanged bool
+}
+
+// loopWrite is a word of RAM written since the last backward jump, with the
+// value it had then.
+type loopWrite struct {
+	address uint16
+	value   uint16
+}
+
+// maxLoopWrites bounds the words of RAM a loop may write and still be found
+// to leave the state as it was.
+const maxLoopWrites = 16
+
+func New() *Computer {
+	return &Computer{}
+}
+
+// Load copies a program into ROM, clears the rest of ROM and resets the CPU.
+func (c *Computer) Load(words []uint16) error {
+	if len(words) > ROMSize {
+		return fmt.Errorf("program has %d words, but ROM holds %d", len(words), ROMSize)
+	}
+	c.ROM = [ROMSize]uint16{}
+	copy(c.ROM[:], words)
+	c.Reset()
+	return nil
+}
+
+// LoadHack loads a program in the textual .hack format.
+func (c *Computer) LoadHack(r io.Reader) error {
+	words, err := hackasm.ReadHack(r)
+	if err != nil {
+		return err
+	}
+	return c.Load(words)
+}
+
+// Reset restarts the program from ROM[0], as the reset input of CPU.hdl.
+// Registers other than PC and the RAM keep their values.
+func (c *Computer) Reset() {
+	c.PC = 0
+	c.Cycles = 0
+	c.halted = false
+	c.loopStarted = false
+}
+
+// SetKey sets the keyboard register to the Hack character code key, or 0
+// when no key is pressed.
+func (c *Computer) SetKey(key uint16) {
+	c.RAM[Keyboard] = key
+}
+
+// Halted reports whether the program is stuck in a loop that can no longer
+// change any state, such as the conventional (END) @END 0;JMP or the
+// while (true) {} loop of Sys.halt.
+func (c *Computer) Halted() bool {
+	return c.halted
+}
+
+// Step executes the instruction at PC.
+//
+// The program halts when a backward jump is taken from the same address
+// twice in a row with the same A and D, the RAM written in between holds
+// the values it had, and no instruction read the keyboard: the computer is
+// then in the same state as before and will loop forever.
+func (c *Computer) Step() {
+	if c.Keys != nil {
+		c.RAM[Keyboard] = c.Keys.Key(c.Cycles)
+	}
+
+	instruction := c.ROM[c.PC]
+	c.Cycles++
+
+	if instruction&0x8000 == 0 {
+		c.A = instruction
+		c.PC = (c.PC + 1) & (ROMSize - 1)
+		return
+	}
+
+	address := c.A & (RAMSize - 1)
+	y := c.A
+	if instruction&0x1000 != 0 {
+		y = c.RAM[address]
+		if address == Keyboard {
+			c.loopChanged = true
+		}
+	}
+
+	out := alu(c.D, y, instruction)
+
+	if instruction&0x0008 != 0 && address != Keyboard {
+		c.recordWrite(address)
+		c.RAM[address] = out
+	}
+	if instruction&0x0010 != 0 {
+		c.D = out
+	}
+	target := c.A
+	if instruction&0x0020 != 0 {
+		c.A = out
+	}
+
+	if jumps(out, instruction) {
+		if target&(ROMSize-1) <= c.PC {
+			c.backwardJump()
+		}
+		c.PC = target & (ROMSize - 1)
+	} else {
+		c.PC = (c.PC + 1) & (ROMSize - 1)
+	}
+}
+
+// Run executes at most n instructions and stops early when the program
+// halts. It returns the number of instructions executed.
+func (c *Computer) Run(n uint64) uint64 {
+	var i uint64
+	for ; i < n && !c.halted; i++ {
+		c.Step()
+	}
+	return i
+}
+
+// backwardJump is called when the jump at PC goes back, which every loop
+// does once per iteration. It halts the program when the loop since the
+// last backward jump from PC left the state as it was.
+func (c *Computer) backwardJump() {
+	if c.loopStarted && c.loopFrom == c.PC && c.loopA == c.A && c.loopD == c.D && !c.loopChanged {
+		c.halted = true
+		for _, w := range c.loopWrites {
+			if c.RAM[w.address] != w.value {
+				c.halted = false
+				break
+			}
+		}
+		if c.halted {
+			return
+		}
+	}
+	c.loopFrom, c.loopA, c.loopD = c.PC, c.A, c.D
+	c.loopWrites = c.loopWrites[:0]
+	c.loopStarted = true
+	c.loopChanged = false
+}
+
+// recordWrite remembers the value of RAM[address] before the loop first
+// writes it.
+func (c *Computer) recordWrite(address uint16) {
+	if c.loopChanged {
+		return
+	}
+	for _, w := range c.loopWrites {
+		if w.address == address {
+			return
+		}
+	}
+	if len(c.loopWrites) == maxLoopWrites {
+		c.loopChanged = true
+		return
+	}
+	c.loopWrites = append(c.loopWrites, loopWrite{address: address, value: c.RAM[address]})
+}
+
+// alu computes the comp field of the C-instruction with x = D and y = A or M,
+// following the control bits of ALU.hdl.
+func alu(x uint16, y uint16, instruction uint16) uint16 {
+	if instruction&0x0800 != 0 { // zx
+		x = 0
+	}
+	if instruction&0x0400 != 0 { // nx
+		x = ^x
+	}
+	if instruction&0x0200 != 0 { // zy
+		y = 0
+	}
+	if instruction&0x0100 != 0 { // ny
+		y = ^y
+	}
+
+	var out uint16
+	if instruction&0x0080 != 0 { // f
+		out = x + y
+	} else {
+		out = x & y
+	}
+
+	if instruction&0x0040 != 0 { // no
+		out = ^out
+	}
+	return out
+}
+
+// jumps evaluates the jump field of the C-instruction for the ALU output.
+func jumps(out uint16, instruction uint16) bool {
+	zr := out == 0
+	ng := out&0x8000 != 0
+	return instruction&0x0004 != 0 && ng ||
+		instruction&0x0002 != 0 && zr ||
+		instruction&0x0001 != 0 && !zr && !ng
+}
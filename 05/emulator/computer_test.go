@@ -0,0 +1,102 @@
+package emulator_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+	"github.com/ebakazu/nand2tetris/08/vm"
+	"github.com/ebakazu/nand2tetris/11/jackc"
+)
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		halts  bool
+		cycles uint64
+	}{
+		{"end loop", "@7\nD=A\n(END)\n@END\n0;JMP", true, 6},
+		{"conditional end loop", "(END)\n@END\nD;JEQ", true, 4},
+		{"count down", "@3\nD=A\n(LOOP)\nD=D-1\n@LOOP\nD;JGT\n(END)\n@END\n0;JMP", true, 15},
+		{"push and pop", "@256\nD=A\n@SP\nM=D\n(LOOP)\n@SP\nAM=M+1\nA=A-1\nM=-1\n@SP\nAM=M-1\nD=M\n@LOOP\nD;JNE", true, 22},
+		{"counter in memory", "(LOOP)\n@x\nM=M+1\n@LOOP\n0;JMP", false, 0},
+		{"toggle", "(LOOP)\n@x\nM=!M\n@LOOP\n0;JMP", false, 0},
+		{"keyboard", "(LOOP)\n@KBD\nD=M\n@LOOP\nD;JEQ", false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			words, err := hackasm.Assemble(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := emulator.New()
+			if err := c.Load(words); err != nil {
+				t.Fatal(err)
+			}
+			n := c.Run(1000)
+			if c.Halted() != test.halts {
+				t.Fatalf("got halted %v after %d cycles, want %v", c.Halted(), n, test.halts)
+			}
+			if test.halts && n != test.cycles {
+				t.Errorf("halted after %d cycles, want %d", n, test.cycles)
+			}
+		})
+	}
+}
+
+// TestHaltJack runs a Jack program linked with the OS until Sys.halt.
+func TestHaltJack(t *testing.T) {
+	main := `class Main {
+    function void main() {
+        do Memory.poke(8000, Math.multiply(6, 7));
+        return;
+    }
+}`
+	files := []vm.File{compile(t, "Main", []byte(main))}
+	locs, err := filepath.Glob("../../12/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range locs {
+		src, err := os.ReadFile(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, compile(t, strings.TrimSuffix(filepath.Base(loc), ".jack"), src))
+	}
+
+	var asm bytes.Buffer
+	if _, err := vm.Translate(&asm, files, vm.Options{Bootstrap: true, SharedRoutines: true, RemoveUnused: true}); err != nil {
+		t.Fatal(err)
+	}
+	words, err := hackasm.Assemble(&asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := emulator.New()
+	if err := c.Load(words); err != nil {
+		t.Fatal(err)
+	}
+	n := c.Run(10000000)
+	if !c.Halted() {
+		t.Fatalf("stopped after %d cycles without halting", n)
+	}
+	if c.RAM[8000] != 42 {
+		t.Errorf("RAM[8000] is %d, want 42", c.RAM[8000])
+	}
+}
+
+func compile(t *testing.T, name string, src []byte) vm.File {
+	var code bytes.Buffer
+	if err := jackc.Compile(&code, src); err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	return vm.File{Name: name, Src: &code}
+}
@@ -0,0 +1,175 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Special key codes of the Hack character set.
+const (
+	KeyNewline   = 128
+	KeyBackspace = 129
+	KeyLeft      = 130
+	KeyUp        = 131
+	KeyRight     = 132
+	KeyDown      = 133
+	KeyHome      = 134
+	KeyEnd       = 135
+	KeyPageUp    = 136
+	KeyPageDown  = 137
+	KeyInsert    = 138
+	KeyDelete    = 139
+	KeyEscape    = 140
+	KeyF1        = 141 // F1 to F12 are 141 to 152
+)
+
+var keyNames = map[string]uint16{
+	"space":     ' ',
+	"newline":   KeyNewline,
+	"enter":     KeyNewline,
+	"backspace": KeyBackspace,
+	"left":      KeyLeft,
+	"up":        KeyUp,
+	"right":     KeyRight,
+	"down":      KeyDown,
+	"home":      KeyHome,
+	"end":       KeyEnd,
+	"pageup":    KeyPageUp,
+	"pagedown":  KeyPageDown,
+	"insert":    KeyInsert,
+	"delete":    KeyDelete,
+	"esc":       KeyEscape,
+}
+
+func init() {
+	for i := 0; i < 12; i++ {
+		keyNames["f"+strconv.Itoa(i+1)] = KeyF1 + uint16(i)
+	}
+}
+
+// Keystroke holds Key down for Duration cycles, starting at cycle Start.
+type Keystroke struct {
+	Key      uint16
+	Start    uint64
+	Duration uint64
+}
+
+type keyChange struct {
+	cycle uint64
+	key   uint16
+}
+
+// KeyScript drives the keyboard register from a list of timed keystrokes.
+// When keystrokes overlap, the one that started last is seen.
+type KeyScript struct {
+	changes []keyChange // sorted by cycle
+}
+
+func NewKeyScript(strokes []Keystroke) *KeyScript {
+	var cycles []uint64
+	for _, k := range strokes {
+		cycles = append(cycles, k.Start, k.Start+k.Duration)
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i] < cycles[j] })
+
+	s := &KeyScript{}
+	for _, cycle := range cycles {
+		if len(s.changes) > 0 && s.changes[len(s.changes)-1].cycle == cycle {
+			continue
+		}
+		var key uint16
+		var start uint64
+		for _, k := range strokes {
+			if k.Start <= cycle && cycle < k.Start+k.Duration && (key == 0 || k.Start >= start) {
+				key, start = k.Key, k.Start
+			}
+		}
+		s.changes = append(s.changes, keyChange{cycle: cycle, key: key})
+	}
+	return s
+}
+
+// Key returns the key held down at cycle, or 0 if there is none.
+func (s *KeyScript) Key(cycle uint64) uint16 {
+	i := sort.Search(len(s.changes), func(i int) bool { return s.changes[i].cycle > cycle })
+	if i == 0 {
+		return 0
+	}
+	return s.changes[i-1].key
+}
+
+// Next returns the first cycle after cycle at which the key changes.
+func (s *KeyScript) Next(cycle uint64) (uint64, bool) {
+	i := sort.Search(len(s.changes), func(i int) bool { return s.changes[i].cycle > cycle })
+	if i == len(s.changes) {
+		return 0, false
+	}
+	return s.changes[i].cycle, true
+}
+
+// ReadKeyScript reads keystrokes, one per line, in the form
+//
+//	key start duration
+//
+// where key is a single character (digits included), a character code of
+// two or more digits or a key name such as left, newline or f1, and start
+// and duration are counted in cycles. Text after // is a comment.
+func ReadKeyScript(r io.Reader) (*KeyScript, error) {
+	var strokes []Keystroke
+
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := s.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want key, start and duration, got %q", line, strings.TrimSpace(text))
+		}
+
+		key, err := ParseKey(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start cycle %q", line, fields[1])
+		}
+		duration, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil || duration == 0 {
+			return nil, fmt.Errorf("line %d: invalid duration %q", line, fields[2])
+		}
+		strokes = append(strokes, Keystroke{Key: key, Start: start, Duration: duration})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewKeyScript(strokes), nil
+}
+
+// ParseKey returns the Hack character code named by s: a number, a single
+// printable character or a key name.
+func ParseKey(s string) (uint16, error) {
+	if key, ok := keyNames[strings.ToLower(s)]; ok {
+		return key, nil
+	}
+	if len(s) == 1 && s[0] >= ' ' && s[0] <= '~' {
+		return uint16(s[0]), nil
+	}
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil || v == 0 || v > 32767 {
+		return 0, fmt.Errorf("unknown key %q", s)
+	}
+	return uint16(v), nil
+}
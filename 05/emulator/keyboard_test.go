@@ -0,0 +1,143 @@
+package emulator_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		s    string
+		want uint16
+	}{
+		{"a", 'a'},
+		{"7", '7'},
+		{"~", '~'},
+		{"65", 65},
+		{"0x41", 65},
+		{"space", ' '},
+		{"Enter", emulator.KeyNewline},
+		{"newline", emulator.KeyNewline},
+		{"backspace", emulator.KeyBackspace},
+		{"LEFT", emulator.KeyLeft},
+		{"esc", emulator.KeyEscape},
+		{"f1", emulator.KeyF1},
+		{"F12", 152},
+	}
+	for _, test := range tests {
+		got, err := emulator.ParseKey(test.s)
+		if err != nil {
+			t.Errorf("%s: %s", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "00", "f13", "shift", "32768", "é"} {
+		if got, err := emulator.ParseKey(s); err == nil {
+			t.Errorf("%q: got %d, want an error", s, got)
+		}
+	}
+}
+
+func TestKeyScript(t *testing.T) {
+	src := `// key start duration
+a 10 5
+b 12 10  // starts while a is held
+newline 30 1
+`
+	s, err := emulator.ReadKeyScript(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cycle uint64
+		key   uint16
+		next  uint64 // 0 if the key does not change after cycle
+	}{
+		{0, 0, 10},
+		{9, 0, 10},
+		{10, 'a', 12},
+		{11, 'a', 12},
+		{12, 'b', 15},
+		{15, 'b', 22},
+		{21, 'b', 22},
+		{22, 0, 30},
+		{30, emulator.KeyNewline, 31},
+		{31, 0, 0},
+		{1000, 0, 0},
+	}
+	for _, test := range tests {
+		if got := s.Key(test.cycle); got != test.key {
+			t.Errorf("Key(%d) = %d, want %d", test.cycle, got, test.key)
+		}
+		next, ok := s.Next(test.cycle)
+		if ok != (test.next != 0) || next != test.next {
+			t.Errorf("Next(%d) = %d, %v, want %d", test.cycle, next, ok, test.next)
+		}
+	}
+}
+
+func TestKeyScriptOverlap(t *testing.T) {
+	// the keystroke that started last is seen, also when it ends first
+	s := emulator.NewKeyScript([]emulator.Keystroke{
+		{Key: 'x', Start: 0, Duration: 100},
+		{Key: 'y', Start: 10, Duration: 5},
+	})
+	for cycle, want := range map[uint64]uint16{0: 'x', 10: 'y', 14: 'y', 15: 'x', 99: 'x', 100: 0} {
+		if got := s.Key(cycle); got != want {
+			t.Errorf("Key(%d) = %d, want %d", cycle, got, want)
+		}
+	}
+}
+
+func TestReadKeyScriptErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a 1", "line 1: want key, start and duration, got \"a 1\""},
+		{"\nshift 1 1", "line 2: unknown key \"shift\""},
+		{"a x 1", "line 1: invalid start cycle \"x\""},
+		{"a 1 0", "line 1: invalid duration \"0\""},
+	}
+	for _, test := range tests {
+		_, err := emulator.ReadKeyScript(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got %v, want %s", test.src, err, test.want)
+		}
+	}
+}
+
+// TestKeysDriveKeyboard runs a program that copies the keyboard register to
+// RAM[0] under a key script.
+func TestKeysDriveKeyboard(t *testing.T) {
+	words, err := hackasm.Assemble(strings.NewReader("(LOOP)\n@KBD\nD=M\n@R0\nM=D\n@LOOP\n0;JMP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := emulator.New()
+	if err := c.Load(words); err != nil {
+		t.Fatal(err)
+	}
+	c.Keys = emulator.NewKeyScript([]emulator.Keystroke{{Key: 'k', Start: 6, Duration: 6}})
+
+	var seen []uint16
+	for i := 0; i < 4; i++ {
+		c.Run(6)
+		seen = append(seen, c.RAM[0])
+	}
+	if want := []uint16{0, 'k', 0, 0}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got %v, want %v", seen, want)
+	}
+	if c.Halted() {
+		t.Error("a program that reads the keyboard halted")
+	}
+}
@@ -0,0 +1,41 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+const (
+	ScreenWidth  = 512
+	ScreenHeight = 256
+)
+
+var screenPalette = color.Palette{color.White, color.Black}
+
+// ScreenImage returns the current contents of the screen memory map.
+func (c *Computer) ScreenImage() *image.Paletted {
+	return RenderScreen(c.RAM[Screen : Screen+ScreenSize])
+}
+
+// WriteScreenPNG writes the screen as a black and white PNG image.
+func (c *Computer) WriteScreenPNG(w io.Writer) error {
+	return png.Encode(w, c.ScreenImage())
+}
+
+// RenderScreen draws the words of a screen memory map. As in Screen.hdl,
+// row r starts at word 32*r and the least significant bit of each word is
+// its leftmost pixel; a set bit is black.
+func RenderScreen(screen []uint16) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, ScreenWidth, ScreenHeight), screenPalette)
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			word := screen[y*ScreenWidth/16+x/16]
+			if word&(1<<uint(x%16)) != 0 {
+				img.Pix[y*img.Stride+x] = 1
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+// stackBase is where the VM translator places the bottom of the stack.
+const stackBase = 256
+
+type label struct {
+	name    string
+	address int
+}
+
+type watch struct {
+	address int
+	old     uint16
+}
+
+// debugger runs a Computer under the control of commands read from the
+// user. The listing and symbol map are optional; without them locations are
+// shown as disassembled instructions.
+type debugger struct {
+	c   *emulator.Computer
+	out io.Writer
+
+	source    map[int]hackasm.ListingEntry
+	labels    []label // sorted by address
+	symbols   map[string]int
+	variables map[string]int
+
+	breakpoints map[int]bool
+	watches     []watch
+
+	last        string
+	interrupted int32
+}
+
+func newDebugger(c *emulator.Computer, out io.Writer, listing hackasm.Listing, symbols hackasm.SymbolMap) *debugger {
+	d := &debugger{
+		c:           c,
+		out:         out,
+		source:      map[int]hackasm.ListingEntry{},
+		symbols:     symbols.Labels,
+		variables:   symbols.Variables,
+		breakpoints: map[int]bool{},
+	}
+	for _, e := range listing.Entries {
+		d.source[e.Address] = e
+	}
+	for name, address := range symbols.Labels {
+		d.labels = append(d.labels, label{name: name, address: address})
+	}
+	sort.Slice(d.labels, func(i, j int) bool {
+		if d.labels[i].address != d.labels[j].address {
+			return d.labels[i].address < d.labels[j].address
+		}
+		// prefer function entries over the labels generated inside them
+		if len(d.labels[i].name) != len(d.labels[j].name) {
+			return len(d.labels[i].name) > len(d.labels[j].name)
+		}
+		return d.labels[i].name > d.labels[j].name
+	})
+	return d
+}
+
+// Interrupt stops a running continue or step command at the next
+// instruction. It is safe to call from another goroutine.
+func (d *debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupted, 1)
+}
+
+const help = `break|b LOC          stop before executing ROM address or label LOC
+delete|d [LOC]       remove the breakpoint at LOC, or all breakpoints
+watch|w CELL         stop when RAM cell CELL (address or symbol) changes
+unwatch CELL         remove the watchpoint on CELL
+info|i               list breakpoints and watchpoints
+step|s [N]           execute N instructions (default 1)
+continue|c           run until a breakpoint, watchpoint or halt
+reset                restart the program from ROM[0]
+regs|r               show A, D, PC and the VM pointers
+stack [N]            show the N topmost stack entries (default 8)
+print|p CELL[-CELL]  show RAM cells
+set CELL|A|D|PC N    change a RAM cell or a register
+list|l [N]           show N instructions around PC (default 5)
+screen FILE          write the screen to FILE as a PNG image
+quit|q               leave the debugger
+An empty line repeats the last command.
+`
+
+// Exec runs one command line and reports whether the debugger should quit.
+func (d *debugger) Exec(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = d.last
+	}
+	d.last = line
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case "break", "b":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: break LOC")
+		}
+		address, err := d.location(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.breakpoints[address] = true
+		fmt.Fprintf(d.out, "breakpoint at %s\n", d.describe(address))
+	case "delete", "d":
+		if len(args) == 0 {
+			d.breakpoints = map[int]bool{}
+			return false, nil
+		}
+		address, err := d.location(args[0])
+		if err != nil {
+			return false, err
+		}
+		if !d.breakpoints[address] {
+			return false, fmt.Errorf("no breakpoint at %s", d.describe(address))
+		}
+		delete(d.breakpoints, address)
+	case "watch", "w":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: watch CELL")
+		}
+		address, err := d.cell(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.watches = append(d.watches, watch{address: address, old: d.c.RAM[address]})
+		fmt.Fprintf(d.out, "watchpoint on %s\n", d.cellName(address))
+	case "unwatch":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: unwatch CELL")
+		}
+		address, err := d.cell(args[0])
+		if err != nil {
+			return false, err
+		}
+		for i, w := range d.watches {
+			if w.address == address {
+				d.watches = append(d.watches[:i], d.watches[i+1:]...)
+				return false, nil
+			}
+		}
+		return false, fmt.Errorf("no watchpoint on %s", d.cellName(address))
+	case "info", "i":
+		d.info()
+	case "step", "s":
+		n := uint64(1)
+		if len(args) > 0 {
+			v, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil || v == 0 {
+				return false, fmt.Errorf("invalid step count %q", args[0])
+			}
+			n = v
+		}
+		d.run(n)
+	case "continue", "c":
+		d.run(^uint64(0))
+	case "reset":
+		d.c.Reset()
+		d.where()
+	case "regs", "r":
+		d.regs()
+	case "stack":
+		n := 8
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v <= 0 {
+				return false, fmt.Errorf("invalid entry count %q", args[0])
+			}
+			n = v
+		}
+		d.stack(n)
+	case "print", "p":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: print CELL[-CELL]")
+		}
+		return false, d.print(args[0])
+	case "set":
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: set CELL|A|D|PC VALUE")
+		}
+		return false, d.set(args[0], args[1])
+	case "list", "l":
+		n := 5
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v <= 0 {
+				return false, fmt.Errorf("invalid line count %q", args[0])
+			}
+			n = v
+		}
+		d.list(n)
+	case "screen":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: screen FILE")
+		}
+		return false, d.screen(args[0])
+	case "help", "h":
+		fmt.Fprint(d.out, help)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q; type help for a list", cmd)
+	}
+	return false, nil
+}
+
+// run executes at most n instructions. It stops before an instruction with
+// a breakpoint, after an instruction that changes a watched cell, when the
+// program halts or when it is interrupted.
+func (d *debugger) run(n uint64) {
+	atomic.StoreInt32(&d.interrupted, 0)
+
+	for i := uint64(0); i < n; i++ {
+		if d.c.Halted() {
+			fmt.Fprintf(d.out, "program halted after %d cycles\n", d.c.Cycles)
+			break
+		}
+		if i > 0 && d.breakpoints[int(d.c.PC)] {
+			fmt.Fprintln(d.out, "hit breakpoint")
+			break
+		}
+		if atomic.LoadInt32(&d.interrupted) != 0 {
+			fmt.Fprintln(d.out, "interrupted")
+			break
+		}
+
+		d.c.Step()
+		if d.checkWatches() {
+			break
+		}
+	}
+	d.where()
+}
+
+// checkWatches reports the watched cells changed by the last instruction.
+func (d *debugger) checkWatches() bool {
+	changed := false
+	for i, w := range d.watches {
+		v := d.c.RAM[w.address]
+		if v == w.old {
+			continue
+		}
+		fmt.Fprintf(d.out, "watchpoint %s: %d -> %d\n", d.cellName(w.address), int16(w.old), int16(v))
+		d.watches[i].old = v
+		changed = true
+	}
+	return changed
+}
+
+// where shows the instruction about to be executed.
+func (d *debugger) where() {
+	fmt.Fprintf(d.out, "=> %s\n", d.line(int(d.c.PC)))
+}
+
+// line formats the instruction at address with its source line if known.
+func (d *debugger) line(address int) string {
+	if e, ok := d.source[address]; ok {
+		return fmt.Sprintf("%-24s %s:%d: %s", d.describe(address), e.File, e.Line, strings.TrimSpace(e.Source))
+	}
+	cmd, err := hackasm.DisassembleWord(d.c.ROM[address])
+	if err != nil {
+		cmd = fmt.Sprintf(".word 0x%04X", d.c.ROM[address])
+	}
+	return fmt.Sprintf("%-24s %s", d.describe(address), cmd)
+}
+
+// describe names a ROM address relative to the closest label before it,
+// e.g. "42 <Main.main+3>".
+func (d *debugger) describe(address int) string {
+	i := sort.Search(len(d.labels), func(i int) bool { return d.labels[i].address > address })
+	if i == 0 {
+		return strconv.Itoa(address)
+	}
+	l := d.labels[i-1]
+	if l.address == address {
+		return fmt.Sprintf("%d <%s>", address, l.name)
+	}
+	return fmt.Sprintf("%d <%s+%d>", address, l.name, address-l.address)
+}
+
+// location resolves a breakpoint location: a ROM address or a label.
+func (d *debugger) location(s string) (int, error) {
+	if address, ok := d.symbols[s]; ok {
+		return address, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 15)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither a ROM address nor a label", s)
+	}
+	return int(v), nil
+}
+
+// cell resolves a RAM cell: an address, a variable or a predefined symbol.
+func (d *debugger) cell(s string) (int, error) {
+	if address, ok := d.variables[s]; ok {
+		return address, nil
+	}
+	if address, ok := hackasm.NewSymbolTable().GetAddress(s); ok {
+		return address, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 15)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither a RAM address nor a variable", s)
+	}
+	return int(v), nil
+}
+
+func (d *debugger) cellName(address int) string {
+	for name, a := range d.variables {
+		if a == address {
+			return fmt.Sprintf("RAM[%d] (%s)", address, name)
+		}
+	}
+	return fmt.Sprintf("RAM[%d]", address)
+}
+
+func (d *debugger) info() {
+	var addresses []int
+	for address := range d.breakpoints {
+		addresses = append(addresses, address)
+	}
+	sort.Ints(addresses)
+	for _, address := range addresses {
+		fmt.Fprintf(d.out, "breakpoint %s\n", d.line(address))
+	}
+	for _, w := range d.watches {
+		fmt.Fprintf(d.out, "watchpoint %s = %d\n", d.cellName(w.address), int16(d.c.RAM[w.address]))
+	}
+}
+
+func (d *debugger) regs() {
+	fmt.Fprintf(d.out, "A=%d D=%d PC=%d cycles=%d\n", int16(d.c.A), int16(d.c.D), d.c.PC, d.c.Cycles)
+	fmt.Fprintf(d.out, "SP=%d LCL=%d ARG=%d THIS=%d THAT=%d\n",
+		d.c.RAM[0], d.c.RAM[1], d.c.RAM[2], d.c.RAM[3], d.c.RAM[4])
+}
+
+// stack shows up to n entries below SP, topmost first, without going below
+// the stack base.
+func (d *debugger) stack(n int) {
+	sp := int(d.c.RAM[0])
+	if sp <= stackBase || sp > emulator.Screen {
+		fmt.Fprintf(d.out, "stack is empty (SP=%d)\n", sp)
+		return
+	}
+	for address := sp - 1; address >= stackBase && address >= sp-n; address-- {
+		fmt.Fprintf(d.out, "SP-%-3d RAM[%d]=%d\n", sp-address, address, int16(d.c.RAM[address]))
+	}
+}
+
+func (d *debugger) print(arg string) error {
+	bounds := strings.SplitN(arg, "-", 2)
+	from, err := d.cell(bounds[0])
+	if err != nil {
+		return err
+	}
+	to := from
+	if len(bounds) == 2 {
+		if to, err = d.cell(bounds[1]); err != nil {
+			return err
+		}
+		if to < from {
+			return fmt.Errorf("invalid RAM range %q", arg)
+		}
+	}
+
+	for address := from; address <= to; address++ {
+		fmt.Fprintf(d.out, "%s=%d\n", d.cellName(address), int16(d.c.RAM[address]))
+	}
+	return nil
+}
+
+func (d *debugger) set(target string, value string) error {
+	v, err := strconv.ParseInt(value, 0, 32)
+	if err != nil || v < -32768 || v > 65535 {
+		return fmt.Errorf("invalid value %q", value)
+	}
+
+	switch target {
+	case "A":
+		d.c.A = uint16(v)
+	case "D":
+		d.c.D = uint16(v)
+	case "PC":
+		if v < 0 || v >= emulator.ROMSize {
+			return fmt.Errorf("invalid ROM address %q", value)
+		}
+		d.c.PC = uint16(v)
+	default:
+		address, err := d.cell(target)
+		if err != nil {
+			return err
+		}
+		d.c.RAM[address] = uint16(v)
+		for i := range d.watches {
+			if d.watches[i].address == address {
+				d.watches[i].old = uint16(v)
+			}
+		}
+	}
+	return nil
+}
+
+// list shows n instructions starting a little before PC.
+func (d *debugger) list(n int) {
+	from := int(d.c.PC) - n/2
+	if from < 0 {
+		from = 0
+	}
+	for address := from; address < from+n && address < emulator.ROMSize; address++ {
+		marker := "  "
+		if address == int(d.c.PC) {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %s\n", marker, d.line(address))
+	}
+}
+
+func (d *debugger) screen(fPath string) error {
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return d.c.WriteScreenPNG(out)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+// newMultDebugger loads the multiplication program of chapter 04 with its
+// listing and symbols to multiply 3 by 2.
+func newMultDebugger(t *testing.T) (*debugger, *bytes.Buffer) {
+	src, err := os.ReadFile("../../04/mult/mult.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := hackasm.NewAssembler("mult.asm")
+	words, err := a.Assemble(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := emulator.New()
+	if err := c.Load(words); err != nil {
+		t.Fatal(err)
+	}
+	c.RAM[0], c.RAM[1] = 3, 2
+
+	out := &bytes.Buffer{}
+	return newDebugger(c, out, a.Listing(), a.SymbolMap()), out
+}
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"list 3", "=> 0                        mult.asm:10: @i\n" +
+			"   1                        mult.asm:11: M=1 // iのワードを初期化\n" +
+			"   2                        mult.asm:12: @R2\n"},
+		{"break LOOP", "breakpoint at 4 <LOOP>\n"},
+		{"c", "hit breakpoint\n=> 4 <LOOP>                 mult.asm:15: @i\n"},
+		{"watch R2", "watchpoint on RAM[2]\n"},
+		{"watch i", "watchpoint on RAM[16] (i)\n"},
+		{"info", "breakpoint 4 <LOOP>                 mult.asm:15: @i\n" +
+			"watchpoint RAM[2] = 0\nwatchpoint RAM[16] (i) = 1\n"},
+		{"c", "watchpoint RAM[2]: 0 -> 3\n=> 14 <LOOP+10>             mult.asm:25: @i\n"},
+		{"", "watchpoint RAM[16] (i): 1 -> 2\n=> 16 <LOOP+12>             mult.asm:27: @LOOP\n"},
+		{"unwatch R2", ""},
+		{"unwatch i", ""},
+		{"print R0-R2", "RAM[0]=3\nRAM[1]=2\nRAM[2]=3\n"},
+		{"set R0 -4", ""},
+		{"print 0", "RAM[0]=-4\n"},
+		{"regs", "A=16 D=3 PC=16 cycles=16\nSP=65532 LCL=2 ARG=3 THIS=0 THAT=0\n"},
+		{"step 2", "=> 4 <LOOP>                 mult.asm:15: @i\n"},
+		{"delete LOOP", ""},
+		{"continue", "program halted after 42 cycles\n=> 18 <END>                 mult.asm:30: @END\n"},
+		{"print R2", "RAM[2]=-1\n"},
+		{"reset", "=> 0                        mult.asm:10: @i\n"},
+		{"quit", ""},
+	}
+
+	d, out := newMultDebugger(t)
+	for _, test := range tests {
+		out.Reset()
+		quit, err := d.Exec(test.cmd)
+		if err != nil {
+			t.Fatalf("%s: %s", test.cmd, err)
+		}
+		if quit != (test.cmd == "quit") {
+			t.Errorf("%s: got quit %v", test.cmd, quit)
+		}
+		if out.String() != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.cmd, out.String(), test.want)
+		}
+	}
+}
+
+func TestDebuggerErrors(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"frobnicate", "unknown command \"frobnicate\"; type help for a list"},
+		{"break", "usage: break LOC"},
+		{"break NOWHERE", "\"NOWHERE\" is neither a ROM address nor a label"},
+		{"delete 3", "no breakpoint at 3"},
+		{"watch nobody", "\"nobody\" is neither a RAM address nor a variable"},
+		{"unwatch 5", "no watchpoint on RAM[5]"},
+		{"step 0", "invalid step count \"0\""},
+		{"print 5-3", "invalid RAM range \"5-3\""},
+		{"set R0 70000", "invalid value \"70000\""},
+		{"set PC 40000", "invalid ROM address \"40000\""},
+	}
+
+	d, _ := newMultDebugger(t)
+	for _, test := range tests {
+		_, err := d.Exec(test.cmd)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.cmd, err, test.want)
+		}
+	}
+}
+
+func TestDebuggerStack(t *testing.T) {
+	d, out := newMultDebugger(t)
+	d.c.RAM[0] = 259
+	d.c.RAM[256], d.c.RAM[257], d.c.RAM[258] = 7, 8, 0xFFFF
+
+	if _, err := d.Exec("stack 2"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "SP-1   RAM[258]=-1\nSP-2   RAM[257]=8\n"; out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	d.c.RAM[0] = 256
+	if _, err := d.Exec("stack"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "stack is empty (SP=256)\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("got %s, want %s", out.String(), want)
+	}
+}
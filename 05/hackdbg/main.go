@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func main() {
+	listingPath := flag.String("listing", "", "listing written by the assembler's -listing flag (default <name>.lst.json if present)")
+	symbolsPath := flag.String("symbols", "", "symbol map written by the assembler's -symbols flag (default <name>.sym.json if present)")
+	keys := flag.String("keys", "", "file of timed keystrokes (key start duration) that drive the keyboard")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-listing file.lst.json] [-symbols file.sym.json] [-keys file] file.hack|file.asm\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	fPath := flag.Arg(0)
+
+	c := emulator.New()
+	var listing hackasm.Listing
+	var symbols hackasm.SymbolMap
+	if strings.HasSuffix(fPath, ".asm") {
+		a, err := assemble(c, fPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listing, symbols = a.Listing(), a.SymbolMap()
+	} else {
+		if err := loadHack(c, fPath); err != nil {
+			log.Fatal(err)
+		}
+		base := strings.TrimSuffix(fPath, ".hack")
+		if err := readDebugFile(*listingPath, base+".lst.json", &listing); err != nil {
+			log.Fatal(err)
+		}
+		if err := readDebugFile(*symbolsPath, base+".sym.json", &symbols); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *keys != "" {
+		script, err := readKeyScript(*keys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Keys = script
+	}
+
+	d := newDebugger(c, os.Stdout, listing, symbols)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			d.Interrupt()
+		}
+	}()
+
+	d.where()
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(hdb) ")
+		if !in.Scan() {
+			fmt.Println()
+			break
+		}
+		quit, err := d.Exec(in.Text())
+		if err != nil {
+			fmt.Println(err)
+		}
+		if quit {
+			break
+		}
+	}
+	if err := in.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// assemble assembles an .asm file into c and returns the assembler, which
+// holds the listing and symbols.
+func assemble(c *emulator.Computer, fPath string) (*hackasm.Assembler, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	a := hackasm.NewAssembler(fPath)
+	words, err := a.Assemble(file)
+	if err != nil {
+		return nil, err
+	}
+	return a, c.Load(words)
+}
+
+func loadHack(c *emulator.Computer, fPath string) error {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.LoadHack(bufio.NewReader(file))
+}
+
+func readKeyScript(fPath string) (*emulator.KeyScript, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys, err := emulator.ReadKeyScript(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fPath, err)
+	}
+	return keys, nil
+}
+
+// readDebugFile decodes the listing or symbol map at fPath. Without fPath it
+// tries defaultPath and leaves v empty if that does not exist.
+func readDebugFile(fPath string, defaultPath string, v interface{}) error {
+	if fPath == "" {
+		if _, err := os.Stat(defaultPath); err != nil {
+			return nil
+		}
+		fPath = defaultPath
+	}
+
+	file, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := hackasm.ReadJSON(file, v); err != nil {
+		return fmt.Errorf("%s: %s", fPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/05/tst"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func main() {
+	cycles := flag.Uint64("cycles", 10000000, "maximum number of instructions to execute")
+	set := flag.String("set", "", "comma-separated RAM initializations, e.g. 0=256,1=300")
+	dump := flag.String("dump", "0-15", "comma-separated RAM addresses or ranges to print, e.g. 0-15,256")
+	screen := flag.String("screen", "", "write the screen to this PNG file when the program halts or stops")
+	every := flag.Uint64("screen-every", 0, "with -screen, also write the screen every n cycles to <name>-<cycle>.png")
+	keys := flag.String("keys", "", "file of timed keystrokes (key start duration) that drive the keyboard")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-cycles n] [-set addr=value,...] [-dump ranges] [-screen file.png [-screen-every n]] [-keys file] file.hack|file.asm\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s script.tst ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 && strings.HasSuffix(flag.Arg(0), ".tst") {
+		if !runScripts(flag.Args()) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	fPath := flag.Arg(0)
+
+	c := emulator.New()
+	if err := load(c, fPath); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := setRAM(c, *set); err != nil {
+		log.Fatal(err)
+	}
+
+	if *keys != "" {
+		script, err := readKeyScript(*keys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Keys = script
+	}
+
+	if *every > 0 && *screen == "" {
+		log.Fatal("-screen-every needs -screen")
+	}
+
+	n, err := run(c, *cycles, *every, func() error {
+		return writeScreen(c, snapshotLocation(*screen, c.Cycles))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Halted() {
+		fmt.Printf("halted after %d cycles\n", n)
+	} else {
+		fmt.Printf("stopped after %d cycles\n", n)
+	}
+	fmt.Printf("A=%d D=%d PC=%d\n", int16(c.A), int16(c.D), c.PC)
+
+	if err := dumpRAM(c, *dump); err != nil {
+		log.Fatal(err)
+	}
+
+	if *screen != "" {
+		if err := writeScreen(c, *screen); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// run executes at most n instructions like Computer.Run, calling snapshot
+// whenever the cycle count reaches a multiple of every.
+func run(c *emulator.Computer, n uint64, every uint64, snapshot func() error) (uint64, error) {
+	if every == 0 {
+		return c.Run(n), nil
+	}
+
+	var done uint64
+	for done < n && !c.Halted() {
+		chunk := every - c.Cycles%every
+		if chunk > n-done {
+			chunk = n - done
+		}
+		done += c.Run(chunk)
+		if c.Cycles%every == 0 {
+			if err := snapshot(); err != nil {
+				return done, err
+			}
+		}
+	}
+	return done, nil
+}
+
+// snapshotLocation numbers a screen file with the cycle it was taken at.
+func snapshotLocation(fPath string, cycles uint64) string {
+	ext := path.Ext(fPath)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(fPath, ext), cycles, ext)
+}
+
+func writeScreen(c *emulator.Computer, fPath string) error {
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return c.WriteScreenPNG(out)
+}
+
+// runScripts runs test scripts and reports whether all of them passed.
+func runScripts(locs []string) bool {
+	ok := true
+	for _, loc := range locs {
+		r := tst.NewRunner()
+		r.Echo = os.Stdout
+		if err := r.RunFile(loc); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s\n", err)
+			ok = false
+			continue
+		}
+		fmt.Printf("ok   %s\n", loc)
+	}
+	return ok
+}
+
+func readKeyScript(fPath string) (*emulator.KeyScript, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys, err := emulator.ReadKeyScript(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fPath, err)
+	}
+	return keys, nil
+}
+
+// load loads a .hack file, or assembles an .asm file first.
+func load(c *emulator.Computer, fPath string) error {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(fPath, ".asm") {
+		return c.LoadHack(file)
+	}
+
+	words, err := hackasm.NewAssembler(fPath).Assemble(file)
+	if err != nil {
+		return err
+	}
+	return c.Load(words)
+}
+
+func setRAM(c *emulator.Computer, set string) error {
+	if set == "" {
+		return nil
+	}
+
+	for _, s := range strings.Split(set, ",") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid RAM initialization %q", s)
+		}
+		address, err := strconv.ParseUint(strings.TrimSpace(kv[0]), 10, 15)
+		if err != nil {
+			return fmt.Errorf("invalid RAM address %q", kv[0])
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+		if err != nil || value < -32768 || value > 65535 {
+			return fmt.Errorf("invalid RAM value %q", kv[1])
+		}
+		c.RAM[address] = uint16(value)
+	}
+	return nil
+}
+
+func dumpRAM(c *emulator.Computer, ranges string) error {
+	if ranges == "" {
+		return nil
+	}
+
+	for _, r := range strings.Split(ranges, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		from, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 15)
+		if err != nil {
+			return fmt.Errorf("invalid RAM range %q", r)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 15); err != nil || to < from {
+				return fmt.Errorf("invalid RAM range %q", r)
+			}
+		}
+
+		for address := from; address <= to; address++ {
+			fmt.Printf("RAM[%d]=%d\n", address, int16(c.RAM[address]))
+		}
+	}
+	return nil
+}
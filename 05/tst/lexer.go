@@ -0,0 +1,68 @@
+package tst
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	Word tokenType = iota
+	String
+	Symbol
+)
+
+type token struct {
+	tokenType tokenType
+	value     string
+	line      int
+}
+
+// tokenize splits a test script into words, quoted strings and the
+// punctuation , ; ! { }. Comments are dropped.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"':
+			end := strings.IndexAny(src[i+1:], "\"\n")
+			if end < 0 || src[i+1+end] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{tokenType: String, value: src[i+1 : i+1+end], line: line})
+			i += end + 2
+		case strings.ContainsRune(",;!{}", rune(c)):
+			tokens = append(tokens, token{tokenType: Symbol, value: string(c), line: line})
+			i++
+		default:
+			start := i
+			for i < len(src) && !unicode.IsSpace(rune(src[i])) && !strings.ContainsRune(",;!{}\"", rune(src[i])) &&
+				!strings.HasPrefix(src[i:], "//") && !strings.HasPrefix(src[i:], "/*") {
+				i++
+			}
+			tokens = append(tokens, token{tokenType: Word, value: src[start:i], line: line})
+		}
+	}
+	return tokens, nil
+}
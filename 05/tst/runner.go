@@ -0,0 +1,491 @@
+package tst
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+// maxWhileIterations bounds while loops whose condition never becomes false.
+const maxWhileIterations = 10000000
+
+// CompareError is returned when an output line differs from the .cmp file.
+type CompareError struct {
+	Script   string
+	Line     int // line of the .cmp file
+	Expected string
+	Actual   string
+}
+
+func (e *CompareError) Error() string {
+	return fmt.Sprintf("%s: comparison failure at line %d\nexpected: %s\nactual:   %s", e.Script, e.Line, e.Expected, e.Actual)
+}
+
+type outputVar struct {
+	name   string
+	format byte
+	padL   int
+	length int
+	padR   int
+}
+
+// Runner executes a test script. The script's load, output-file and
+// compare-to paths are relative to its directory.
+type Runner struct {
+	Computer *emulator.Computer
+
+	// Echo receives the text of echo commands. It may be nil.
+	Echo io.Writer
+
+	name       string
+	dir        string
+	outputList []outputVar
+	outFile    *os.File
+	out        *bufio.Writer
+	cmp        []string
+	outLines   int
+}
+
+func NewRunner() *Runner {
+	return &Runner{Computer: emulator.New()}
+}
+
+// RunFile runs the test script at path.
+func RunFile(path string) error {
+	return NewRunner().RunFile(path)
+}
+
+func (r *Runner) RunFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.Run(path, string(src))
+}
+
+// Run runs the script src. name is used in errors and to resolve the files
+// the script refers to.
+func (r *Runner) Run(name string, src string) error {
+	r.name = name
+	r.dir = filepath.Dir(name)
+
+	commands, err := parseScript(src)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	err = r.execute(commands)
+	if closeErr := r.closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.cmp != nil && r.outLines < len(r.cmp) {
+		return fmt.Errorf("%s: only %d of %d lines of the comparison file were output", name, r.outLines, len(r.cmp))
+	}
+	return nil
+}
+
+// scriptError is a failed command of a script.
+type scriptError struct {
+	script string
+	line   int
+	name   string
+	err    error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.script, e.line, e.name, e.err)
+}
+
+func (r *Runner) execute(commands []command) error {
+	for _, c := range commands {
+		if err := r.executeCommand(c); err != nil {
+			switch err.(type) {
+			case *CompareError, *scriptError:
+				return err
+			}
+			return &scriptError{script: r.name, line: c.line, name: c.name, err: err}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) executeCommand(c command) error {
+	switch c.name {
+	case "load":
+		if len(c.args) != 1 {
+			return fmt.Errorf("expect a file name")
+		}
+		return r.load(r.path(c.args[0].value))
+
+	case "output-file":
+		if len(c.args) != 1 {
+			return fmt.Errorf("expect a file name")
+		}
+		if err := r.closeOutput(); err != nil {
+			return err
+		}
+		f, err := os.Create(r.path(c.args[0].value))
+		if err != nil {
+			return err
+		}
+		r.outFile = f
+		r.out = bufio.NewWriter(f)
+		return nil
+
+	case "compare-to":
+		if len(c.args) != 1 {
+			return fmt.Errorf("expect a file name")
+		}
+		b, err := os.ReadFile(r.path(c.args[0].value))
+		if err != nil {
+			return err
+		}
+		r.cmp = strings.Split(strings.TrimRight(strings.Replace(string(b), "\r\n", "\n", -1), "\n"), "\n")
+		return nil
+
+	case "output-list":
+		r.outputList = nil
+		for _, arg := range c.args {
+			v, err := parseOutputVar(arg.value)
+			if err != nil {
+				return err
+			}
+			r.outputList = append(r.outputList, v)
+		}
+		return r.output(r.header())
+
+	case "output":
+		values, err := r.values()
+		if err != nil {
+			return err
+		}
+		return r.output(values)
+
+	case "set":
+		if len(c.args) != 2 {
+			return fmt.Errorf("expect a variable and a value")
+		}
+		value, err := parseValue(c.args[1].value)
+		if err != nil {
+			return err
+		}
+		return r.set(c.args[0].value, value)
+
+	case "ticktock", "tock":
+		r.Computer.Step()
+		return nil
+
+	case "tick":
+		return nil
+
+	case "repeat":
+		for i := 0; i < c.count; i++ {
+			if err := r.execute(c.body); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "while":
+		for i := 0; ; i++ {
+			ok, err := r.condition(c.args)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			if i == maxWhileIterations {
+				return fmt.Errorf("condition still true after %d iterations", maxWhileIterations)
+			}
+			if err := r.execute(c.body); err != nil {
+				return err
+			}
+		}
+
+	case "echo":
+		if r.Echo != nil {
+			var words []string
+			for _, arg := range c.args {
+				words = append(words, arg.value)
+			}
+			fmt.Fprintln(r.Echo, strings.Join(words, " "))
+		}
+		return nil
+
+	case "clear-echo":
+		return nil
+	}
+
+	return fmt.Errorf("unsupported command")
+}
+
+func (r *Runner) closeOutput() error {
+	if r.outFile == nil {
+		return nil
+	}
+	err := r.out.Flush()
+	if closeErr := r.outFile.Close(); err == nil {
+		err = closeErr
+	}
+	r.outFile, r.out = nil, nil
+	return err
+}
+
+func (r *Runner) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r.dir, name)
+}
+
+// load loads a .hack file, or assembles an .asm file first.
+func (r *Runner) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".asm") {
+		return r.Computer.LoadHack(f)
+	}
+
+	words, err := hackasm.NewAssembler(path).Assemble(f)
+	if err != nil {
+		return err
+	}
+	return r.Computer.Load(words)
+}
+
+// output writes line to the output file and checks it against the
+// comparison file.
+func (r *Runner) output(line string) error {
+	if r.out != nil {
+		if _, err := fmt.Fprintln(r.out, line); err != nil {
+			return err
+		}
+	}
+
+	r.outLines++
+	if r.cmp == nil {
+		return nil
+	}
+	if r.outLines > len(r.cmp) {
+		return &CompareError{Script: r.name, Line: r.outLines, Actual: line}
+	}
+	if expected := r.cmp[r.outLines-1]; !sameLine(expected, line) {
+		return &CompareError{Script: r.name, Line: r.outLines, Expected: expected, Actual: line}
+	}
+	return nil
+}
+
+// sameLine compares output lines cell by cell, ignoring the alignment within
+// cells. A cell of asterisks in the expected line matches anything.
+func sameLine(expected string, actual string) bool {
+	e := strings.Split(expected, "|")
+	a := strings.Split(actual, "|")
+	if len(e) != len(a) {
+		return false
+	}
+	for i := range e {
+		want := strings.TrimSpace(e[i])
+		if want != strings.TrimSpace(a[i]) && strings.Trim(want, "*") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Runner) header() string {
+	var cells []string
+	for _, v := range r.outputList {
+		width := v.padL + v.length + v.padR
+		name := v.name
+		if len(name) > width {
+			name = name[:width]
+		}
+		left := (width - len(name)) / 2
+		cells = append(cells, strings.Repeat(" ", left)+name+strings.Repeat(" ", width-left-len(name)))
+	}
+	return "|" + strings.Join(cells, "|") + "|"
+}
+
+// values formats the variables of the output list, failing on a variable
+// that does not exist rather than printing it as 0.
+func (r *Runner) values() (string, error) {
+	var cells []string
+	for _, v := range r.outputList {
+		value, err := r.get(v.name)
+		if err != nil {
+			return "", err
+		}
+
+		var s string
+		switch v.format {
+		case 'D':
+			s = strconv.Itoa(int(int16(value)))
+		case 'X':
+			s = fmt.Sprintf("%04X", value)
+		case 'B':
+			s = fmt.Sprintf("%016b", value)
+		case 'S':
+			s = string(rune(value))
+		}
+
+		if len(s) > v.length {
+			s = s[len(s)-v.length:]
+		}
+		s = strings.Repeat(" ", v.length-len(s)) + s
+		cells = append(cells, strings.Repeat(" ", v.padL)+s+strings.Repeat(" ", v.padR))
+	}
+	return "|" + strings.Join(cells, "|") + "|", nil
+}
+
+// parseOutputVar parses an output-list entry such as RAM[256]%D2.6.2.
+func parseOutputVar(s string) (outputVar, error) {
+	v := outputVar{name: s, format: 'B', padL: 1, length: 16, padR: 1}
+
+	i := strings.Index(s, "%")
+	if i < 0 {
+		return v, nil
+	}
+	v.name = s[:i]
+
+	spec := s[i+1:]
+	if spec == "" || !strings.ContainsRune("DXBS", rune(spec[0])) {
+		return outputVar{}, fmt.Errorf("invalid format %q", s)
+	}
+	v.format = spec[0]
+
+	parts := strings.Split(spec[1:], ".")
+	if len(parts) != 3 {
+		return outputVar{}, fmt.Errorf("invalid format %q", s)
+	}
+	for j, p := range []*int{&v.padL, &v.length, &v.padR} {
+		n, err := strconv.Atoi(parts[j])
+		if err != nil || n < 0 {
+			return outputVar{}, fmt.Errorf("invalid format %q", s)
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+// parseValue parses a script value: decimal, or %D, %X and %B prefixed.
+func parseValue(s string) (uint16, error) {
+	base := 10
+	digits := s
+	if strings.HasPrefix(s, "%") && len(s) > 1 {
+		switch s[1] {
+		case 'D':
+			base = 10
+		case 'X':
+			base = 16
+		case 'B':
+			base = 2
+		default:
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		digits = s[2:]
+	}
+
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || n < -32768 || n > 65535 {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return uint16(n), nil
+}
+
+func (r *Runner) get(name string) (uint16, error) {
+	c := r.Computer
+	switch name {
+	case "A":
+		return c.A, nil
+	case "D":
+		return c.D, nil
+	case "PC":
+		return c.PC, nil
+	case "time":
+		return uint16(c.Cycles), nil
+	}
+
+	address, err := ramAddress(name)
+	if err != nil {
+		return 0, err
+	}
+	return c.RAM[address], nil
+}
+
+func (r *Runner) set(name string, value uint16) error {
+	c := r.Computer
+	switch name {
+	case "A":
+		c.A = value
+		return nil
+	case "D":
+		c.D = value
+		return nil
+	case "PC":
+		c.PC = value & (emulator.ROMSize - 1)
+		return nil
+	}
+
+	address, err := ramAddress(name)
+	if err != nil {
+		return err
+	}
+	c.RAM[address] = value
+	return nil
+}
+
+func ramAddress(name string) (int, error) {
+	if !strings.HasPrefix(name, "RAM[") || !strings.HasSuffix(name, "]") {
+		return 0, fmt.Errorf("unknown variable %s", name)
+	}
+	address, err := strconv.Atoi(name[4 : len(name)-1])
+	if err != nil || address < 0 || address >= emulator.RAMSize {
+		return 0, fmt.Errorf("invalid address %s", name)
+	}
+	return address, nil
+}
+
+// condition evaluates a while condition: variable operator value.
+func (r *Runner) condition(args []token) (bool, error) {
+	left, err := r.get(args[0].value)
+	if err != nil {
+		return false, err
+	}
+	right, err := parseValue(args[2].value)
+	if err != nil {
+		return false, err
+	}
+
+	x, y := int16(left), int16(right)
+	switch args[1].value {
+	case "=":
+		return x == y, nil
+	case "<>":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case ">":
+		return x > y, nil
+	case "<=":
+		return x <= y, nil
+	case ">=":
+		return x >= y, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", args[1].value)
+}
@@ -0,0 +1,131 @@
+package tst
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputVar(t *testing.T) {
+	tests := []struct {
+		s    string
+		want outputVar
+	}{
+		{"RAM[256]%D2.6.2", outputVar{name: "RAM[256]", format: 'D', padL: 2, length: 6, padR: 2}},
+		{"RAM[0]%X1.4.1", outputVar{name: "RAM[0]", format: 'X', padL: 1, length: 4, padR: 1}},
+		{"A%B0.16.0", outputVar{name: "A", format: 'B', padL: 0, length: 16, padR: 0}},
+		{"RAM[3]%S1.1.1", outputVar{name: "RAM[3]", format: 'S', padL: 1, length: 1, padR: 1}},
+		{"D", outputVar{name: "D", format: 'B', padL: 1, length: 16, padR: 1}},
+	}
+	for _, test := range tests {
+		got, err := parseOutputVar(test.s)
+		if err != nil {
+			t.Errorf("%s: %s", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"A%", "A%Q1.2.3", "A%D1.2", "A%D1.2.3.4", "A%D1.x.1", "A%D-1.6.1"} {
+		if got, err := parseOutputVar(s); err == nil {
+			t.Errorf("%s: got %+v, want an error", s, got)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		list []outputVar
+		want string
+	}{
+		{[]outputVar{{name: "RAM[0]", padL: 1, length: 6, padR: 1}}, "| RAM[0] |"},
+		{[]outputVar{{name: "A", padL: 1, length: 6, padR: 1}}, "|   A    |"},
+		{[]outputVar{{name: "RAM[256]", padL: 1, length: 4, padR: 1}}, "|RAM[25|"},
+		{[]outputVar{
+			{name: "RAM[0]", padL: 2, length: 6, padR: 2},
+			{name: "D", padL: 1, length: 1, padR: 1},
+		}, "|  RAM[0]  | D |"},
+	}
+	for _, test := range tests {
+		r := &Runner{outputList: test.list}
+		if got := r.header(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestSameLine(t *testing.T) {
+	tests := []struct {
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"|  257  |", "|  257  |", true},
+		{"|  257  |", "|257|", true},
+		{"|  257  |", "|  258  |", false},
+		{"| ***** |  10 |", "|  -1  |  10 |", true},
+		{"| ***** |  10 |", "|  -1  |  11 |", false},
+		{"|   |", "|  0  |", true},
+		{"|  1  |  2  |", "|  1  |", false},
+		{"|  1  |", "|  1  |  2  |", false},
+	}
+	for _, test := range tests {
+		if got := sameLine(test.expected, test.actual); got != test.want {
+			t.Errorf("sameLine(%q, %q) = %v, want %v", test.expected, test.actual, got, test.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	const script = `load Prog.asm,
+compare-to Prog.cmp,
+output-list RAM[0]%D1.6.1 D%X1.4.1;
+output;
+ticktock; ticktock; ticktock; ticktock;
+output;
+`
+	tests := []struct {
+		cmp  string
+		line int // line of the .cmp file that differs, 0 if none
+	}{
+		{"| RAM[0] |  D   |\n|      0 | 0000 |\n|      5 | 0005 |\n", 0},
+		{"| RAM[0] |  D   |\n|      0 | 0000 |\n|  ***** | 0005 |\n", 0},
+		{"| RAM[0] |  D   |\n|      0 | 0000 |\n|      6 | 0005 |\n", 3},
+		{"| RAM[1] |  D   |\n", 1},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		for name, src := range map[string]string{
+			"Prog.asm": "@5\nD=A\n@0\nM=D",
+			"Prog.cmp": test.cmp,
+			"Prog.tst": script,
+		} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := RunFile(filepath.Join(dir, "Prog.tst"))
+		var cmpErr *CompareError
+		switch {
+		case test.line == 0 && err != nil:
+			t.Errorf("%q: %s", test.cmp, err)
+		case test.line != 0 && !errors.As(err, &cmpErr):
+			t.Errorf("%q: got %v, want a comparison failure", test.cmp, err)
+		case test.line != 0 && cmpErr.Line != test.line:
+			t.Errorf("%q: got a failure at line %d, want %d", test.cmp, cmpErr.Line, test.line)
+		}
+	}
+}
+
+func TestRunUnknownVariable(t *testing.T) {
+	err := NewRunner().Run("Prog.tst", "output-list RAM[O]%D1.6.1;\noutput;")
+	if err == nil || !strings.Contains(err.Error(), "Prog.tst:2: output: ") {
+		t.Errorf("got %v, want an error of the output command", err)
+	}
+}
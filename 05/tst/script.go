@@ -0,0 +1,143 @@
+// Package tst runs nand2tetris CPU emulator test scripts (.tst) against the
+// Go Hack emulator and compares their output with .cmp files.
+package tst
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// command is a statement of a test script. repeat and while hold a body.
+type command struct {
+	name  string
+	args  []token
+	line  int
+	body  []command
+	count int
+}
+
+type scriptParser struct {
+	tokens []token
+	idx    int
+}
+
+func parseScript(src string) ([]command, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &scriptParser{tokens: tokens}
+	commands, err := p.commands()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.get(); ok {
+		return nil, fmt.Errorf("line %d: unexpected %q", t.line, t.value)
+	}
+	return commands, nil
+}
+
+func (p *scriptParser) get() (token, bool) {
+	if p.idx < len(p.tokens) {
+		return p.tokens[p.idx], true
+	}
+	return token{}, false
+}
+
+func (p *scriptParser) next() {
+	p.idx++
+}
+
+// commands parses statements up to a closing brace or the end of the script.
+func (p *scriptParser) commands() ([]command, error) {
+	var commands []command
+
+	for {
+		t, ok := p.get()
+		if !ok || (t.tokenType == Symbol && t.value == "}") {
+			return commands, nil
+		}
+		if t.tokenType != Word {
+			return nil, fmt.Errorf("line %d: expect a command, but %q", t.line, t.value)
+		}
+
+		var c command
+		var err error
+		switch t.value {
+		case "repeat", "while":
+			c, err = p.loop()
+		default:
+			c, err = p.simple()
+		}
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+}
+
+func (p *scriptParser) simple() (command, error) {
+	t, _ := p.get()
+	c := command{name: t.value, line: t.line}
+	p.next()
+
+	for {
+		t, ok := p.get()
+		if !ok {
+			return command{}, fmt.Errorf("line %d: missing ',' or ';' after %s", c.line, c.name)
+		}
+		p.next()
+		if t.tokenType == Symbol {
+			if t.value == "," || t.value == ";" || t.value == "!" {
+				return c, nil
+			}
+			return command{}, fmt.Errorf("line %d: unexpected %q", t.line, t.value)
+		}
+		c.args = append(c.args, t)
+	}
+}
+
+// loop parses "repeat n { ... }" and "while condition { ... }".
+func (p *scriptParser) loop() (command, error) {
+	t, _ := p.get()
+	c := command{name: t.value, line: t.line}
+	p.next()
+
+	for {
+		t, ok := p.get()
+		if !ok {
+			return command{}, fmt.Errorf("line %d: missing '{' after %s", c.line, c.name)
+		}
+		p.next()
+		if t.tokenType == Symbol && t.value == "{" {
+			break
+		}
+		c.args = append(c.args, t)
+	}
+
+	if c.name == "repeat" {
+		if len(c.args) != 1 {
+			return command{}, fmt.Errorf("line %d: repeat needs a count", c.line)
+		}
+		n, err := strconv.Atoi(c.args[0].value)
+		if err != nil || n < 0 {
+			return command{}, fmt.Errorf("line %d: invalid repeat count %q", c.line, c.args[0].value)
+		}
+		c.count = n
+	} else if len(c.args) != 3 {
+		return command{}, fmt.Errorf("line %d: while needs a condition such as RAM[0] <> 0", c.line)
+	}
+
+	body, err := p.commands()
+	if err != nil {
+		return command{}, err
+	}
+	if t, ok := p.get(); !ok || t.value != "}" {
+		return command{}, fmt.Errorf("line %d: missing '}'", c.line)
+	}
+	p.next()
+
+	c.body = body
+	return c, nil
+}
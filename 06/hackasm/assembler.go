@@ -0,0 +1,306 @@
+// Package hackasm implements an assembler for the Hack machine language.
+package hackasm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxConstant is the largest value an A-instruction can load.
+const MaxConstant = 1<<15 - 1
+
+// Instruction is a parsed line of Hack assembly.
+type Instruction struct {
+	Type   CommandType
+	Symbol string // value of an A-instruction or a ROM data word, or name of a label
+	Dest   string
+	Comp   string
+	Jump   string
+	Pos    Pos
+	Text   string // original source line
+
+	destColumn int
+	compColumn int
+	jumpColumn int
+}
+
+type Assembler struct {
+	Name string // file name used in diagnostics and to resolve #include
+	St   *SymbolTable
+
+	// Open opens files named by #include. It defaults to os.Open.
+	Open func(name string) (io.ReadCloser, error)
+
+	// Optimize enables the peephole optimizer, see Optimize.
+	Optimize bool
+
+	listing  []ListingEntry
+	report   OptimizeReport
+	hasData  bool
+	inData   bool
+	dataPos  Pos
+	dataInit []dataWord
+}
+
+func NewAssembler(name string) *Assembler {
+	return &Assembler{Name: name, St: NewSymbolTable()}
+}
+
+// Assemble assembles the source read from r with a fresh Assembler.
+func Assemble(r io.Reader) ([]uint16, error) {
+	return NewAssembler("").Assemble(r)
+}
+
+// Assemble reads the whole source from r and translates it into machine
+// words. Every diagnostic found in the source is returned together as an
+// ErrorList. Each call starts with a fresh symbol table, so an Assembler can
+// assemble several sources one after another.
+func (a *Assembler) Assemble(r io.Reader) ([]uint16, error) {
+	var errs ErrorList
+
+	a.St = NewSymbolTable()
+	a.report = OptimizeReport{}
+
+	instructions, err := a.parse(r, &errs)
+	if err != nil {
+		return nil, err
+	}
+
+	words := a.resolve(instructions, &errs)
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// parse is the first pass. It preprocesses the source, reads every
+// instruction and defines labels at the ROM address of the instruction that
+// follows them.
+func (a *Assembler) parse(r io.Reader, errs *ErrorList) ([]Instruction, error) {
+	var instructions []Instruction
+
+	lines, err := ReadSource(a.Name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	pp := NewPreprocessor()
+	pp.Open = a.Open
+	lines, err = pp.Process(lines, errs)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Optimize {
+		lines, a.report = Optimize(lines)
+	}
+
+	rom := 0
+	a.inData = false
+	a.dataInit = nil
+	a.hasData = hasDataSection(lines)
+	if a.hasData {
+		rom = startAddress
+	}
+
+	p := NewParser(lines)
+	for p.Scan() {
+		if err := p.Advance(); err != nil {
+			*errs = append(*errs, err.(*Error))
+			continue
+		}
+		if p.Command == "" {
+			continue
+		}
+
+		switch {
+		case p.CommandType == Directive:
+			if p.Command == ".data" && len(a.dataInit) == 0 {
+				a.dataPos = p.pos(p.Column)
+			}
+			values := a.directive(p, errs)
+			if a.inData {
+				address := a.St.Reserve(len(values))
+				for i, v := range values {
+					a.dataInit = append(a.dataInit, dataWord{address: address + i, value: v})
+				}
+				continue
+			}
+			for _, v := range values {
+				instructions = append(instructions, Instruction{Type: Directive, Symbol: v.expr, Pos: v.pos, Text: v.text})
+				rom++
+			}
+			continue
+		case a.inData && p.CommandType == L:
+			if err := a.St.AddData(p.Command); err != nil {
+				errs.Add(p.pos(p.Column), ErrDuplicateLabel, "%s", err)
+			}
+			continue
+		case a.inData:
+			errs.Add(p.pos(p.Column), ErrDirective, "instruction in .data section; use .code before code")
+			continue
+		case p.CommandType == L:
+			if err := a.St.AddEntry(p.Command, rom); err != nil {
+				errs.Add(p.pos(p.Column), ErrDuplicateLabel, "%s", err)
+			}
+		default:
+			rom++
+		}
+
+		instructions = append(instructions, p.instruction())
+	}
+
+	if a.hasData {
+		jump := []Instruction{
+			generated("@"+strconv.Itoa(rom), a.dataPos, ".data"),
+			generated("0;JMP", a.dataPos, ".data"),
+		}
+		instructions = append(jump, instructions...)
+	}
+
+	return instructions, nil
+}
+
+// OptimizeReport returns what the optimizer saved in the last Assemble call.
+func (a *Assembler) OptimizeReport() OptimizeReport {
+	return a.report
+}
+
+func (p *Parser) instruction() Instruction {
+	return Instruction{
+		Type:       p.CommandType,
+		Symbol:     p.Symbol(),
+		Dest:       p.Dest,
+		Comp:       p.Comp,
+		Jump:       p.Jump,
+		Pos:        p.pos(p.Column),
+		Text:       p.Text,
+		destColumn: p.DestColumn,
+		compColumn: p.CompColumn,
+		jumpColumn: p.JumpColumn,
+	}
+}
+
+// resolve is the second pass. It allocates variables and encodes each
+// instruction, followed by the data prologue if there is one, and checks
+// that the whole program fits in ROM.
+func (a *Assembler) resolve(instructions []Instruction, errs *ErrorList) []uint16 {
+	var words []uint16
+
+	a.listing = nil
+	encode := func(instructions []Instruction) {
+		for _, ins := range instructions {
+			var word uint16
+			var ok bool
+
+			switch ins.Type {
+			case A:
+				word, ok = a.encodeA(ins, errs)
+			case C:
+				word, ok = a.encodeC(ins, errs)
+			case Directive:
+				word, ok = a.evaluateWord(dataValue{expr: ins.Symbol, pos: ins.Pos}, errs)
+			}
+			if !ok {
+				continue
+			}
+
+			a.listing = append(a.listing, ListingEntry{
+				Address: len(words),
+				Word:    fmt.Sprintf("%016b", word),
+				File:    ins.Pos.File,
+				Line:    ins.Pos.Line,
+				Source:  ins.Text,
+			})
+			words = append(words, word)
+		}
+	}
+
+	encode(instructions)
+	var prologue []Instruction
+	if a.hasData {
+		// evaluated last so that data may refer to variables
+		prologue = a.prologue(errs)
+		encode(prologue)
+	}
+
+	// count the words the program would have without errors too, including
+	// the prologue
+	rom := len(prologue)
+	for _, ins := range instructions {
+		if ins.Type != L {
+			rom++
+		}
+	}
+	if rom > MaxConstant+1 {
+		errs.Add(Pos{File: a.Name, Line: 1, Column: 1}, ErrConstantRange, "program needs %d words of ROM, but only %d are available", rom, MaxConstant+1)
+	}
+
+	return words
+}
+
+// encodeA resolves the operand of an A-instruction. A lone symbol that is
+// not yet defined is allocated as a variable; anything else is evaluated as
+// a constant expression.
+func (a *Assembler) encodeA(ins Instruction, errs *ErrorList) (uint16, bool) {
+	column := ins.Pos.Column + 1 + leadingSpaces(ins.Text[strings.Index(ins.Text, "@")+1:])
+
+	var value int
+	if symbolRegexp.MatchString(ins.Symbol) {
+		if v, ok := a.St.GetAddress(ins.Symbol); ok {
+			value = v
+		} else {
+			value = a.St.AddVariable(ins.Symbol)
+		}
+	} else {
+		v, err := evaluate(ins.Symbol, a.St)
+		if err != nil {
+			errs.Add(ins.column(column+err.offset), err.kind, "%s", err.msg)
+			return 0, false
+		}
+		value = v
+	}
+
+	operand := strconv.Itoa(value)
+	if operand != ins.Symbol {
+		operand = fmt.Sprintf("%s (= %d)", ins.Symbol, value)
+	}
+	if value < 0 {
+		errs.Add(ins.column(column), ErrConstantRange, "%s is negative; an A-instruction cannot load it, use a C-instruction such as D=-1", operand)
+		return 0, false
+	}
+	if value > MaxConstant {
+		errs.Add(ins.column(column), ErrConstantRange, "%s is not in range 0..%d", operand, MaxConstant)
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+func (a *Assembler) encodeC(ins Instruction, errs *ErrorList) (uint16, bool) {
+	comp, compOk := Comp(ins.Comp)
+	if !compOk {
+		errs.Add(ins.column(ins.compColumn), ErrUnknownComp, "%q", ins.Comp)
+	}
+	dest, destOk := Dest(ins.Dest)
+	if !destOk {
+		errs.Add(ins.column(ins.destColumn), ErrBadDest, "%q", ins.Dest)
+	}
+	jump, jumpOk := Jump(ins.Jump)
+	if !jumpOk {
+		errs.Add(ins.column(ins.jumpColumn), ErrBadJump, "%q", ins.Jump)
+	}
+	if !compOk || !destOk || !jumpOk {
+		return 0, false
+	}
+
+	word, _ := strconv.ParseUint("111"+comp+dest+jump, 2, 16)
+	return uint16(word), true
+}
+
+func (ins Instruction) column(column int) Pos {
+	pos := ins.Pos
+	pos.Column = column
+	return pos
+}
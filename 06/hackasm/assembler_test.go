@@ -0,0 +1,99 @@
+package hackasm_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []uint16
+	}{
+		{"constant", "@21", []uint16{21}},
+		{"predefined symbols", "@SP\n@R15\n@SCREEN\n@KBD", []uint16{0, 15, 16384, 24576}},
+		{"comp, dest and jump", "D=M\nAM=D+1\n0;JMP\nMD=!A;JLE", []uint16{
+			0b1111110000010000,
+			0b1110011111101000,
+			0b1110101010000111,
+			0b1110110001011110,
+		}},
+		{"spaces in comp", "D = D + M ; JGT", []uint16{0b1111000010010001}},
+		{"variables from RAM[16]", "@i\n@sum\n@i", []uint16{16, 17, 16}},
+		{"labels", "@END\n(LOOP)\n@LOOP\n(END)\n@END", []uint16{2, 1, 2}},
+		{"comments and blank lines", "// comment\n\n  @1 // one\n\tD=A", []uint16{1, 0b1110110000010000}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hackasm.Assemble(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %016b, want %016b", got, test.want)
+			}
+		})
+	}
+}
+
+// TestAssembleMult assembles the multiplication program of chapter 04 and
+// compares it with the machine code of the course's assembler.
+func TestAssembleMult(t *testing.T) {
+	src, err := os.ReadFile("../../04/mult/mult.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../04/mult/mult.hack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words, err := hackasm.NewAssembler("mult.asm").Assemble(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := hackasm.WriteHack(&got, words); err != nil {
+		t.Fatal(err)
+	}
+	if normalize(got.String()) != normalize(string(want)) {
+		t.Errorf("got\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func normalize(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+// TestAssembleTwice checks that labels and variables of one call do not leak
+// into the next one on the same Assembler.
+func TestAssembleTwice(t *testing.T) {
+	a := hackasm.NewAssembler("Prog.asm")
+	tests := []struct {
+		src  string
+		want []uint16
+	}{
+		{"(LOOP)\n@x\n@LOOP", []uint16{16, 0}},
+		{"@y\n(LOOP)\n@LOOP", []uint16{16, 1}},
+	}
+
+	for _, test := range tests {
+		got, err := a.Assemble(strings.NewReader(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.src, got, test.want)
+		}
+	}
+	if want := map[string]int{"y": 16}; !reflect.DeepEqual(a.SymbolMap().Variables, want) {
+		t.Errorf("got variables %v, want %v", a.SymbolMap().Variables, want)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package hackasm
 
 import "strings"
 
@@ -44,27 +44,36 @@ var jumpMap = map[string]string{
 	"JMP": "111",
 }
 
-func Dest(mnemonic string) string {
+// Dest returns the dest bits for mnemonic. ok is false if mnemonic contains
+// anything other than A, D and M or repeats a register.
+func Dest(mnemonic string) (bits string, ok bool) {
 	r := []string{"0", "0", "0"}
 	for _, c := range mnemonic {
+		var i int
 		switch c {
 		case 'A':
-			r[0] = "1"
+			i = 0
 		case 'D':
-			r[1] = "1"
+			i = 1
 		case 'M':
-			r[2] = "1"
+			i = 2
 		default:
-			r = []string{"0", "0", "0"}
+			return "", false
 		}
+		if r[i] == "1" {
+			return "", false
+		}
+		r[i] = "1"
 	}
-	return strings.Join(r, "")
+	return strings.Join(r, ""), true
 }
 
-func Comp(mnemonic string) string {
-	return compMap[mnemonic]
+func Comp(mnemonic string) (string, bool) {
+	bits, ok := compMap[mnemonic]
+	return bits, ok
 }
 
-func Jump(mnemonic string) string {
-	return jumpMap[mnemonic]
+func Jump(mnemonic string) (string, bool) {
+	bits, ok := jumpMap[mnemonic]
+	return bits, ok
 }
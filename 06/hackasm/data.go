@@ -0,0 +1,232 @@
+package hackasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Data directives
+//
+//	.data                 following labels and data go to RAM
+//	.code                 following instructions and data go to ROM
+//	.word 1, 'A', LOOP+1  one word per value
+//	.string "Hello"       one word per character followed by 0
+//	.fill 8, 0xFFFF       count copies of value (default 0)
+//
+// In the code section the values are emitted as constants in ROM. In the
+// data section labels name RAM addresses reserved through the symbol
+// table, and a prologue run before the program initializes them:
+//
+//	@init      // ROM 0
+//	0;JMP
+//	...        // program, starting at ROM 2
+//	(init)     // one store per data word
+//	@2
+//	0;JMP
+
+// startAddress is the ROM address of the program when a prologue is needed.
+const startAddress = 2
+
+// dataValue is a word given by a data directive, not yet evaluated.
+type dataValue struct {
+	expr string
+	pos  Pos
+	text string
+}
+
+// dataWord is a word of RAM initialized by the prologue.
+type dataWord struct {
+	address int
+	value   dataValue
+}
+
+type dataArg struct {
+	text   string
+	column int
+}
+
+func hasDataSection(lines []SourceLine) bool {
+	for _, line := range lines {
+		if txt, _ := stripLine(line.Text); txt == ".data" {
+			return true
+		}
+	}
+	return false
+}
+
+// directive handles a directive in the first pass and returns the values of
+// .word, .string and .fill.
+func (a *Assembler) directive(p *Parser, errs *ErrorList) []dataValue {
+	args := splitArgs(p.Args, p.ArgsColumn)
+	pos := p.pos(p.Column)
+
+	value := func(arg dataArg) dataValue {
+		return dataValue{expr: arg.text, pos: p.pos(arg.column), text: p.Text}
+	}
+
+	switch p.Command {
+	case ".data", ".code":
+		if len(args) > 0 {
+			errs.Add(pos, ErrDirective, "%s takes no arguments", p.Command)
+		}
+		a.inData = p.Command == ".data"
+		return nil
+
+	case ".word":
+		if len(args) == 0 {
+			errs.Add(pos, ErrDirective, ".word needs at least one value")
+		}
+		var values []dataValue
+		for _, arg := range args {
+			values = append(values, value(arg))
+		}
+		return values
+
+	case ".string":
+		if len(args) != 1 {
+			errs.Add(pos, ErrDirective, ".string takes one quoted string")
+			return nil
+		}
+		s, err := strconv.Unquote(args[0].text)
+		if err != nil || !strings.HasPrefix(args[0].text, "\"") {
+			errs.Add(p.pos(args[0].column), ErrDirective, "malformed string %s", args[0].text)
+			return nil
+		}
+		var values []dataValue
+		for _, r := range s {
+			values = append(values, dataValue{expr: strconv.Itoa(int(r)), pos: p.pos(args[0].column), text: p.Text})
+		}
+		return append(values, dataValue{expr: "0", pos: p.pos(args[0].column), text: p.Text})
+
+	case ".fill":
+		if len(args) != 1 && len(args) != 2 {
+			errs.Add(pos, ErrDirective, ".fill takes a count and an optional value")
+			return nil
+		}
+		count, err := evaluate(args[0].text, a.St)
+		if err != nil {
+			errs.Add(p.pos(args[0].column+err.offset), err.kind, "%s", err.msg)
+			return nil
+		}
+		if count < 0 || count > MaxConstant+1 {
+			errs.Add(p.pos(args[0].column), ErrConstantRange, ".fill count %d is not in range 0..%d", count, MaxConstant+1)
+			return nil
+		}
+		fill := dataValue{expr: "0", pos: pos, text: p.Text}
+		if len(args) == 2 {
+			fill = value(args[1])
+		}
+		values := make([]dataValue, count)
+		for i := range values {
+			values[i] = fill
+		}
+		return values
+	}
+
+	errs.Add(pos, ErrDirective, "unknown directive %s", p.Command)
+	return nil
+}
+
+// splitArgs splits comma-separated directive arguments, keeping commas inside
+// quotes. column is the column of args in the source line.
+func splitArgs(args string, column int) []dataArg {
+	var r []dataArg
+	if strings.TrimSpace(args) == "" {
+		return r
+	}
+
+	start := 0
+	var quote byte
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) {
+			c := args[i]
+			switch {
+			case quote != 0 && c == '\\':
+				i++
+				continue
+			case quote != 0 && c == quote:
+				quote = 0
+				continue
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+				continue
+			case quote != 0 || c != ',':
+				continue
+			}
+		}
+		text := args[start:i]
+		r = append(r, dataArg{text: strings.TrimSpace(text), column: column + start + leadingSpaces(text)})
+		start = i + 1
+	}
+	return r
+}
+
+// evaluateWord evaluates a data value as a 16-bit word. Negative values are
+// stored in two's complement.
+func (a *Assembler) evaluateWord(v dataValue, errs *ErrorList) (uint16, bool) {
+	value, err := evaluate(v.expr, a.St)
+	if err != nil {
+		pos := v.pos
+		pos.Column += err.offset
+		errs.Add(pos, err.kind, "%s", err.msg)
+		return 0, false
+	}
+	if value < -(1<<15) || value >= 1<<16 {
+		errs.Add(v.pos, ErrConstantRange, "%s is not a 16-bit value", v.expr)
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+// prologue returns the instructions that store the data section in RAM and
+// then jump to the program.
+func (a *Assembler) prologue(errs *ErrorList) []Instruction {
+	var code []Instruction
+
+	for _, w := range a.dataInit {
+		value, ok := a.evaluateWord(w.value, errs)
+		if !ok {
+			continue
+		}
+
+		at := func(cmd string) {
+			code = append(code, generated(cmd, w.value.pos, w.value.text))
+		}
+
+		switch value {
+		case 0, 1, 0xFFFF:
+			at("@" + strconv.Itoa(w.address))
+			at("M=" + map[uint16]string{0: "0", 1: "1", 0xFFFF: "-1"}[value])
+		default:
+			if value&0x8000 == 0 {
+				at("@" + strconv.Itoa(int(value)))
+				at("D=A")
+			} else {
+				at("@" + strconv.Itoa(int(^value)))
+				at("D=!A")
+			}
+			at("@" + strconv.Itoa(w.address))
+			at("M=D")
+		}
+	}
+
+	code = append(code, generated("@"+strconv.Itoa(startAddress), a.dataPos, ".data"))
+	code = append(code, generated("0;JMP", a.dataPos, ".data"))
+	return code
+}
+
+// generated builds an instruction that the assembler emits on behalf of
+// the source line text at pos.
+func generated(cmd string, pos Pos, text string) Instruction {
+	p := NewParser([]SourceLine{{Pos: pos, Text: cmd}})
+	p.Scan()
+	if err := p.Advance(); err != nil {
+		panic(fmt.Sprintf("hackasm: invalid generated instruction %q", cmd))
+	}
+
+	ins := p.instruction()
+	ins.Pos = pos
+	ins.Text = cmd + " // " + text
+	return ins
+}
@@ -0,0 +1,124 @@
+package hackasm_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+// TestDataLayout checks the ROM of a program with a data section: a jump
+// over the program to the prologue, the program from ROM 2, and the
+// prologue that initializes RAM and jumps back.
+func TestDataLayout(t *testing.T) {
+	src := `.data
+(msg)
+.string "Hi"
+(n)
+.word -2
+(buf)
+.fill 2, 1
+.code
+@msg
+D=M
+(END)
+@END
+0;JMP
+`
+	want := []string{
+		"@6", "0;JMP",
+		"@16", "D=M", "@4", "0;JMP",
+		"@72", "D=A", "@16", "M=D",
+		"@105", "D=A", "@17", "M=D",
+		"@18", "M=0",
+		"@1", "D=!A", "@19", "M=D",
+		"@20", "M=1",
+		"@21", "M=1",
+		"@2", "0;JMP",
+	}
+
+	a := hackasm.NewAssembler("Prog.asm")
+	words, err := a.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := disassemble(t, words); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	wantVars := map[string]int{"msg": 16, "n": 19, "buf": 20}
+	if got := a.SymbolMap().Variables; !reflect.DeepEqual(got, wantVars) {
+		t.Errorf("got variables %v, want %v", got, wantVars)
+	}
+}
+
+func TestDataDirectives(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []uint16
+	}{
+		{"word", "(L)\n.word 1, 'A', L+1, -1", []uint16{1, 65, 1, 0xFFFF}},
+		{"word up to 0xFFFF", ".word 0xFFFF, -32768", []uint16{0xFFFF, 0x8000}},
+		{"string", `.string "a,\"b"`, []uint16{'a', ',', '"', 'b', 0}},
+		{"string with //", `.string "http://x" // comment`, []uint16{'h', 't', 't', 'p', ':', '/', '/', 'x', 0}},
+		{"fill", ".fill 3, 0x7", []uint16{7, 7, 7}},
+		{"fill zeros", ".fill 2", []uint16{0, 0}},
+		{"fill none", ".fill 0\n@1", []uint16{1}},
+		{"labels after data", ".word 5\n(L)\n@L", []uint16{5, 1}},
+		{"data refers to variables", ".data\n(p)\n.word x\n.code\n@x", []uint16{
+			3, 0b1110101010000111, 17, 17, 0b1110110000010000, 16, 0b1110001100001000, 2, 0b1110101010000111,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hackasm.Assemble(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{".data 1", "1:1: bad directive: .data takes no arguments"},
+		{".word", "1:1: bad directive: .word needs at least one value"},
+		{".word 0x10000", "1:7: constant out of range: 0x10000 is not a 16-bit value"},
+		{".word -32769", "1:7: constant out of range: -32769 is not a 16-bit value"},
+		{".word 1, x", "1:10: undefined symbol: x is not defined"},
+		{".string 'a'", "1:9: bad directive: malformed string 'a'"},
+		{".string \"a\", \"b\"", "1:1: bad directive: .string takes one quoted string"},
+		{".fill -1", "1:7: constant out of range: .fill count -1 is not in range 0..32768"},
+		{".fill 1, 2, 3", "1:1: bad directive: .fill takes a count and an optional value"},
+		{".data\n  D=A", "2:3: bad directive: instruction in .data section; use .code before code"},
+		{".data\n(a)\n(a)", "3:1: duplicate label: a already exists"},
+		{".bss", "1:1: bad directive: unknown directive .bss"},
+		{".fill 32768\n.word 1", "1:1: constant out of range: program needs 32769 words of ROM, but only 32768 are available"},
+		{".data\n.fill 16000, 2\n.code", "1:1: constant out of range: program needs 64004 words of ROM, but only 32768 are available"},
+	}
+
+	for _, test := range tests {
+		_, err := hackasm.NewAssembler("Prog.asm").Assemble(strings.NewReader(test.src))
+		if want := "Prog.asm:" + test.want; err == nil || err.Error() != want {
+			t.Errorf("%q: got %v, want %s", test.src, err, want)
+		}
+	}
+}
+
+func disassemble(t *testing.T, words []uint16) []string {
+	var asm bytes.Buffer
+	if err := hackasm.Disassemble(&asm, words, hackasm.DisassembleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(asm.String())
+}
@@ -0,0 +1,157 @@
+package hackasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var compMnemonics = invert(compMap)
+var jumpMnemonics = invert(jumpMap)
+
+var destMnemonics = map[string]string{
+	"000": "",
+	"001": "M",
+	"010": "D",
+	"011": "MD",
+	"100": "A",
+	"101": "AM",
+	"110": "AD",
+	"111": "AMD",
+}
+
+func invert(m map[string]string) map[string]string {
+	r := map[string]string{}
+	for k, v := range m {
+		r[v] = k
+	}
+	return r
+}
+
+// addressNames maps the RAM addresses of predefined symbols to a name,
+// preferring R0-R15 over the VM aliases SP, LCL, ARG, THIS and THAT.
+func addressNames() map[int]string {
+	names := map[int]string{}
+	for symbol, address := range predefinedSymbols {
+		current, ok := names[address]
+		if !ok || (strings.HasPrefix(symbol, "R") && !strings.HasPrefix(current, "R")) {
+			names[address] = symbol
+		}
+	}
+	return names
+}
+
+type DisassembleOptions struct {
+	Labels  bool // reconstruct labels for jump targets
+	Symbols bool // name predefined RAM addresses such as R13, SCREEN and KBD
+}
+
+// ReadHack reads machine words in the textual .hack format.
+func ReadHack(r io.Reader) ([]uint16, error) {
+	var words []uint16
+
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		txt := strings.TrimSpace(s.Text())
+		if txt == "" {
+			continue
+		}
+
+		word, err := strconv.ParseUint(txt, 2, 16)
+		if err != nil || len(txt) != 16 {
+			return nil, fmt.Errorf("line %d: invalid machine word %q", line, txt)
+		}
+		words = append(words, uint16(word))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// DisassembleWord translates a single machine word into assembly.
+func DisassembleWord(word uint16) (string, error) {
+	if word&0x8000 == 0 {
+		return "@" + strconv.Itoa(int(word)), nil
+	}
+
+	bits := fmt.Sprintf("%016b", word)
+	if bits[:3] != "111" {
+		return "", fmt.Errorf("%s is not a valid C-instruction", bits)
+	}
+
+	comp, ok := compMnemonics[bits[3:10]]
+	if !ok {
+		return "", fmt.Errorf("%s has an unknown comp field %s", bits, bits[3:10])
+	}
+	dest := destMnemonics[bits[10:13]]
+	jump := jumpMnemonics[bits[13:]]
+
+	cmd := comp
+	if dest != "" {
+		cmd = dest + "=" + cmd
+	}
+	if jump != "" {
+		cmd += ";" + jump
+	}
+	return cmd, nil
+}
+
+// Disassemble writes words as Hack assembly to w. Words that are not valid
+// instructions are written as .word directives.
+func Disassemble(w io.Writer, words []uint16, opts DisassembleOptions) error {
+	lines := make([]string, len(words))
+	for i, word := range words {
+		cmd, err := DisassembleWord(word)
+		if err != nil {
+			// not an instruction, most likely a ROM constant
+			cmd = fmt.Sprintf(".word 0x%04X", word)
+		}
+		lines[i] = cmd
+	}
+
+	labels := map[int]string{}
+	names := addressNames()
+	for i, word := range words {
+		if word&0x8000 != 0 || i+1 >= len(words) {
+			continue
+		}
+
+		next, _ := DisassembleWord(words[i+1])
+		value := int(word)
+		if opts.Labels && strings.Contains(next, ";") && value <= len(words) {
+			label := "L" + strconv.Itoa(value)
+			labels[value] = label
+			lines[i] = "@" + label
+			continue
+		}
+
+		if opts.Symbols && (usesMemory(next) || value == predefinedSymbols["SCREEN"] || value == predefinedSymbols["KBD"]) {
+			if name, ok := names[value]; ok {
+				lines[i] = "@" + name
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, line := range lines {
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(bw, "(%s)\n", label)
+		}
+		fmt.Fprintln(bw, line)
+	}
+	if label, ok := labels[len(lines)]; ok {
+		fmt.Fprintf(bw, "(%s)\n", label)
+	}
+	return bw.Flush()
+}
+
+// usesMemory reports whether the C-instruction cmd reads or writes M.
+func usesMemory(cmd string) bool {
+	return strings.Contains(strings.SplitN(cmd, ";", 2)[0], "M")
+}
@@ -0,0 +1,123 @@
+package hackasm_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestDisassembleWord(t *testing.T) {
+	tests := []struct {
+		word uint16
+		want string
+	}{
+		{0, "@0"},
+		{32767, "@32767"},
+		{0b1111110000010000, "D=M"},
+		{0b1110101010000111, "0;JMP"},
+		{0b1110110001011110, "MD=!A;JLE"},
+		{0b1111000010111001, "AMD=D+M;JGT"},
+	}
+
+	for _, test := range tests {
+		got, err := hackasm.DisassembleWord(test.word)
+		if err != nil {
+			t.Errorf("%016b: %s", test.word, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%016b: got %s, want %s", test.word, got, test.want)
+		}
+	}
+
+	for _, word := range []uint16{0b1000000000000000, 0b1110111011000000} {
+		if got, err := hackasm.DisassembleWord(word); err == nil {
+			t.Errorf("%016b: got %s, want an error", word, got)
+		}
+	}
+}
+
+// TestDisassembleRoundTrip assembles the programs of chapter 04, disassembles
+// them with each set of options and checks that assembling the result gives
+// the same machine code.
+func TestDisassembleRoundTrip(t *testing.T) {
+	options := []hackasm.DisassembleOptions{
+		{},
+		{Labels: true},
+		{Symbols: true},
+		{Labels: true, Symbols: true},
+	}
+
+	for _, file := range []string{"../../04/mult/mult.asm", "../../04/fill/Fill.asm"} {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		words, err := hackasm.Assemble(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, opts := range options {
+			var asm bytes.Buffer
+			if err := hackasm.Disassemble(&asm, words, opts); err != nil {
+				t.Fatal(err)
+			}
+			got, err := hackasm.Assemble(&asm)
+			if err != nil {
+				t.Fatalf("%s %+v: %s", file, opts, err)
+			}
+			if !reflect.DeepEqual(got, words) {
+				t.Errorf("%s %+v: the disassembly assembles to different words", file, opts)
+			}
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	words := []uint16{
+		2,                  // @2
+		0b1110101010000111, // 0;JMP
+		13,                 // @13
+		0b1111110000010000, // D=M
+		0xFFFF,             // not an instruction
+	}
+
+	tests := []struct {
+		opts hackasm.DisassembleOptions
+		want string
+	}{
+		{hackasm.DisassembleOptions{}, "@2\n0;JMP\n@13\nD=M\n.word 0xFFFF\n"},
+		{hackasm.DisassembleOptions{Labels: true, Symbols: true}, "@L2\n0;JMP\n(L2)\n@R13\nD=M\n.word 0xFFFF\n"},
+	}
+
+	for _, test := range tests {
+		var got bytes.Buffer
+		if err := hackasm.Disassemble(&got, words, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.want {
+			t.Errorf("%+v: got\n%s\nwant\n%s", test.opts, got.String(), test.want)
+		}
+	}
+}
+
+func TestReadHack(t *testing.T) {
+	words, err := hackasm.ReadHack(strings.NewReader("0000000000000010\n\n1110101010000111\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{2, 0b1110101010000111}; !reflect.DeepEqual(words, want) {
+		t.Errorf("got %v, want %v", words, want)
+	}
+
+	for _, src := range []string{"0101", "00000000000000102", "@2"} {
+		if _, err := hackasm.ReadHack(strings.NewReader(src)); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package hackasm
+
+import (
+	"fmt"
+	"sort"
+)
+
+type ErrorKind int
+
+const (
+	ErrSyntax ErrorKind = iota
+	ErrUnknownComp
+	ErrBadDest
+	ErrBadJump
+	ErrDuplicateLabel
+	ErrConstantRange
+	ErrMalformedLabel
+	ErrMalformedSymbol
+	ErrInclude
+	ErrMacro
+	ErrExpression
+	ErrUndefinedSymbol
+	ErrDirective
+)
+
+var ErrorKindMap = map[ErrorKind]string{
+	ErrSyntax:          "syntax error",
+	ErrUnknownComp:     "unknown comp",
+	ErrBadDest:         "bad dest",
+	ErrBadJump:         "bad jump",
+	ErrDuplicateLabel:  "duplicate label",
+	ErrConstantRange:   "constant out of range",
+	ErrMalformedLabel:  "malformed label",
+	ErrMalformedSymbol: "malformed symbol",
+	ErrInclude:         "include error",
+	ErrMacro:           "macro error",
+	ErrExpression:      "bad expression",
+	ErrUndefinedSymbol: "undefined symbol",
+	ErrDirective:       "bad directive",
+}
+
+func (k ErrorKind) String() string {
+	return ErrorKindMap[k]
+}
+
+// Pos is a position in an assembly source. Line and Column are 1-based.
+// Lines that come from a macro have the position of the line in the macro
+// body, and Expansion tells where the macro was invoked.
+type Pos struct {
+	File      string
+	Line      int
+	Column    int
+	Expansion string // e.g. "PUSH at main.asm:12:5", empty outside macros
+}
+
+func (p Pos) String() string {
+	file := p.File
+	if file == "" {
+		file = "<stdin>"
+	}
+	return fmt.Sprintf("%s:%d:%d", file, p.Line, p.Column)
+}
+
+type Error struct {
+	Pos  Pos
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %s: %s", e.Pos, e.Kind, e.Msg)
+	if e.Pos.Expansion != "" {
+		msg += " (in expansion of " + e.Pos.Expansion + ")"
+	}
+	return msg
+}
+
+// ErrorList collects every diagnostic found while assembling a file so that
+// they can be reported at once.
+type ErrorList []*Error
+
+func (l *ErrorList) Add(pos Pos, kind ErrorKind, format string, a ...interface{}) {
+	*l = append(*l, &Error{Pos: pos, Kind: kind, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (l ErrorList) Len() int {
+	return len(l)
+}
+
+func (l ErrorList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l ErrorList) Less(i, j int) bool {
+	if l[i].Pos.File != l[j].Pos.File {
+		return l[i].Pos.File < l[j].Pos.File
+	}
+	if l[i].Pos.Line != l[j].Pos.Line {
+		return l[i].Pos.Line < l[j].Pos.Line
+	}
+	return l[i].Pos.Column < l[j].Pos.Column
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil if the list is empty, otherwise the list sorted by file,
+// then by position in the file.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	sort.Stable(l)
+	return l
+}
@@ -0,0 +1,80 @@
+package hackasm_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"missing value", "@", []string{
+			"Prog.asm:1:1: syntax error: missing value after '@'",
+		}},
+		{"unknown comp", "D=M\n  D=Q", []string{
+			"Prog.asm:2:5: unknown comp: \"Q\"",
+		}},
+		{"bad dest", "  X=M", []string{
+			"Prog.asm:1:3: bad dest: \"X\"",
+		}},
+		{"bad jump", "0; JXX", []string{
+			"Prog.asm:1:4: bad jump: \"JXX\"",
+		}},
+		{"malformed instruction", "D=A=M", []string{
+			"Prog.asm:1:1: syntax error: malformed instruction D=A=M",
+		}},
+		{"duplicate label", "(LOOP)\n@LOOP\n(LOOP)", []string{
+			"Prog.asm:3:1: duplicate label: LOOP already exists",
+		}},
+		{"missing paren", "(LOOP", []string{
+			"Prog.asm:1:1: malformed label: missing ')' in (LOOP",
+		}},
+		{"invalid label", "\t(1LOOP)", []string{
+			"Prog.asm:1:3: malformed label: invalid label name \"1LOOP\"",
+		}},
+		{"constant range", "@ 32768", []string{
+			"Prog.asm:1:3: constant out of range: 32768 is not in range 0..32767",
+		}},
+		{"every error in line order", "X=M\n@32768 // comment\nD;JXX", []string{
+			"Prog.asm:1:1: bad dest: \"X\"",
+			"Prog.asm:2:2: constant out of range: 32768 is not in range 0..32767",
+			"Prog.asm:3:3: bad jump: \"JXX\"",
+		}},
+		{"dest, comp and jump of one line", "X=Q;JXX", []string{
+			"Prog.asm:1:1: bad dest: \"X\"",
+			"Prog.asm:1:3: unknown comp: \"Q\"",
+			"Prog.asm:1:5: bad jump: \"JXX\"",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := hackasm.NewAssembler("Prog.asm").Assemble(strings.NewReader(test.src))
+			var errs hackasm.ErrorList
+			if !errors.As(err, &errs) {
+				t.Fatalf("got %v, want an ErrorList", err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestErrorWithoutName(t *testing.T) {
+	_, err := hackasm.Assemble(strings.NewReader("D=Q"))
+	want := "<stdin>:1:3: unknown comp: \"Q\""
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
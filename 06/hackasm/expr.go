@@ -0,0 +1,190 @@
+package hackasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// exprError is an error at a byte offset within an A-instruction operand.
+type exprError struct {
+	offset int
+	kind   ErrorKind
+	msg    string
+}
+
+// exprParser evaluates A-instruction operands at assembly time.
+//
+//	expr    = unary { ("+" | "-") unary }
+//	unary   = ("+" | "-") unary | primary
+//	primary = decimal | "0x" hex | "0b" binary | "'" char "'" | symbol | "(" expr ")"
+//
+// Symbols in an expression must be labels, predefined symbols or variables
+// that are already allocated. A malformed operand is reported before any
+// undefined symbol in it.
+type exprParser struct {
+	src string
+	pos int
+	st  *SymbolTable
+
+	undefined *exprError // the first undefined symbol
+}
+
+func evaluate(src string, st *SymbolTable) (int, *exprError) {
+	e := &exprParser{src: src, st: st}
+	v, err := e.expr()
+	if err != nil {
+		return 0, err
+	}
+
+	e.skipSpaces()
+	if e.pos < len(e.src) {
+		// "a b" and "a#b" are malformed symbols rather than expressions
+		next, prev := e.src[e.pos], e.src[e.pos-1]
+		if isSymbolChar(next) || isSymbolChar(prev) && !strings.ContainsRune(")*/&|", rune(next)) {
+			return 0, e.errorf(ErrMalformedSymbol, "unexpected %q after %q", e.src[e.pos:], strings.TrimSpace(e.src[:e.pos]))
+		}
+		return 0, e.errorf(ErrExpression, "unexpected %q", e.src[e.pos:])
+	}
+	if e.undefined != nil {
+		return 0, e.undefined
+	}
+	return v, nil
+}
+
+func (e *exprParser) errorf(kind ErrorKind, format string, a ...interface{}) *exprError {
+	return &exprError{offset: e.pos, kind: kind, msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *exprParser) skipSpaces() {
+	for e.pos < len(e.src) && (e.src[e.pos] == ' ' || e.src[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+func (e *exprParser) peek() byte {
+	e.skipSpaces()
+	if e.pos < len(e.src) {
+		return e.src[e.pos]
+	}
+	return 0
+}
+
+func (e *exprParser) expr() (int, *exprError) {
+	v, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		switch e.peek() {
+		case '+':
+			e.pos++
+			w, err := e.unary()
+			if err != nil {
+				return 0, err
+			}
+			v += w
+		case '-':
+			e.pos++
+			w, err := e.unary()
+			if err != nil {
+				return 0, err
+			}
+			v -= w
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (e *exprParser) unary() (int, *exprError) {
+	switch e.peek() {
+	case '-':
+		e.pos++
+		v, err := e.unary()
+		return -v, err
+	case '+':
+		e.pos++
+		return e.unary()
+	}
+	return e.primary()
+}
+
+func (e *exprParser) primary() (int, *exprError) {
+	c := e.peek()
+	start := e.pos
+
+	switch {
+	case c == '(':
+		e.pos++
+		v, err := e.expr()
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != ')' {
+			return 0, e.errorf(ErrExpression, "missing ')'")
+		}
+		e.pos++
+		return v, nil
+
+	case c == '\'':
+		r, size := utf8.DecodeRuneInString(e.src[e.pos+1:])
+		if size == 0 || r == '\'' || !strings.HasPrefix(e.src[e.pos+1+size:], "'") {
+			return 0, e.errorf(ErrExpression, "malformed character literal")
+		}
+		e.pos += size + 2
+		return int(r), nil
+
+	case '0' <= c && c <= '9':
+		for e.pos < len(e.src) && isSymbolChar(e.src[e.pos]) {
+			e.pos++
+		}
+		lit := e.src[start:e.pos]
+
+		base, digits := 10, lit
+		switch {
+		case strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X"):
+			base, digits = 16, lit[2:]
+		case strings.HasPrefix(lit, "0b") || strings.HasPrefix(lit, "0B"):
+			base, digits = 2, lit[2:]
+		}
+
+		v, err := strconv.ParseInt(digits, base, 32)
+		if err != nil {
+			e.pos = start
+			if base == 10 && strings.IndexFunc(lit, isLetter) >= 0 {
+				return 0, e.errorf(ErrMalformedSymbol, "%s is not a number, and a symbol cannot start with a digit", lit)
+			}
+			return 0, e.errorf(ErrExpression, "malformed number %q", lit)
+		}
+		return int(v), nil
+
+	case isSymbolChar(c):
+		for e.pos < len(e.src) && isSymbolChar(e.src[e.pos]) {
+			e.pos++
+		}
+		symbol := e.src[start:e.pos]
+
+		v, ok := e.st.GetAddress(symbol)
+		if !ok && e.undefined == nil {
+			e.undefined = &exprError{offset: start, kind: ErrUndefinedSymbol, msg: symbol + " is not defined"}
+		}
+		return v, nil
+	}
+
+	if c == 0 {
+		return 0, e.errorf(ErrExpression, "unexpected end of expression")
+	}
+	return 0, e.errorf(ErrExpression, "unexpected %q", c)
+}
+
+func isLetter(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func isSymbolChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.' || c == '$' || c == ':'
+}
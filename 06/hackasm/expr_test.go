@@ -0,0 +1,78 @@
+package hackasm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		operand string
+		want    uint16
+	}{
+		{"0x7FFF", 32767},
+		{"0Xff", 255},
+		{"0b101", 5},
+		{"0B0", 0},
+		{"'A'", 65},
+		{"' '", 32},
+		{"1+2", 3},
+		{"10-2-3", 5},
+		{"10-(2-3)", 11},
+		{"-(2-5)", 3},
+		{"--1", 1},
+		{"+ 4 - -1", 5},
+		{"KBD-SCREEN", 8192},
+		{"END-1", 2},
+		{"R13 + 'a' - 'A'", 45},
+		{"0x10 + 0b10 + 10", 28},
+	}
+
+	for _, test := range tests {
+		src := "@" + test.operand + "\n@END\n0;JMP\n(END)"
+		words, err := hackasm.Assemble(strings.NewReader(src))
+		if err != nil {
+			t.Errorf("%s: %s", test.operand, err)
+			continue
+		}
+		if words[0] != test.want {
+			t.Errorf("%s: got %d, want %d", test.operand, words[0], test.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		operand string
+		want    string
+	}{
+		{"32767+1", "1:2: constant out of range: 32767+1 (= 32768) is not in range 0..32767"},
+		{"0x8000", "1:2: constant out of range: 0x8000 (= 32768) is not in range 0..32767"},
+		{"1-2", "1:2: constant out of range: 1-2 (= -1) is negative; an A-instruction cannot load it, use a C-instruction such as D=-1"},
+		{"-1", "1:2: constant out of range: -1 is negative; an A-instruction cannot load it, use a C-instruction such as D=-1"},
+		{"99999999999", "1:2: bad expression: malformed number \"99999999999\""},
+		{"0x1G", "1:2: bad expression: malformed number \"0x1G\""},
+		{"0b102", "1:2: bad expression: malformed number \"0b102\""},
+		{"''", "1:2: bad expression: malformed character literal"},
+		{"'ab'", "1:2: bad expression: malformed character literal"},
+		{"(1+2", "1:6: bad expression: missing ')'"},
+		{"1+2)", "1:5: bad expression: unexpected \")\""},
+		{"1+", "1:4: bad expression: unexpected end of expression"},
+		{"1*2", "1:3: bad expression: unexpected \"*2\""},
+		{"a#b", "1:3: malformed symbol: unexpected \"#b\" after \"a\""},
+		{"a b", "1:4: malformed symbol: unexpected \"b\" after \"a\""},
+		{"x+y z", "1:6: malformed symbol: unexpected \"z\" after \"x+y\""},
+		{"1x", "1:2: malformed symbol: 1x is not a number, and a symbol cannot start with a digit"},
+		{"1+x", "1:4: undefined symbol: x is not defined"},
+		{"v+1\n@v", "1:2: undefined symbol: v is not defined"},
+	}
+
+	for _, test := range tests {
+		_, err := hackasm.Assemble(strings.NewReader("@" + test.operand))
+		if want := "<stdin>:" + test.want; err == nil || err.Error() != want {
+			t.Errorf("%s: got %v, want %s", test.operand, err, want)
+		}
+	}
+}
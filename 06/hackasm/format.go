@@ -0,0 +1,154 @@
+package hackasm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Format is an encoding of assembled machine words.
+type Format struct {
+	Name      string
+	Extension string
+	Write     func(w io.Writer, words []uint16) error
+}
+
+var formats = map[string]Format{
+	"hack":    {Name: "hack", Extension: ".hack", Write: WriteHack},
+	"bin":     {Name: "bin", Extension: ".bin", Write: WriteBinary},
+	"ihex":    {Name: "ihex", Extension: ".hex", Write: WriteIntelHex},
+	"memb":    {Name: "memb", Extension: ".memb", Write: WriteMemB},
+	"memh":    {Name: "memh", Extension: ".memh", Write: WriteMemH},
+	"logisim": {Name: "logisim", Extension: ".img", Write: WriteLogisim},
+}
+
+// LookupFormat returns the output format called name.
+func LookupFormat(name string) (Format, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+// FormatNames returns the names accepted by LookupFormat.
+func FormatNames() []string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteHack writes words in the textual .hack format, one 16-digit binary
+// number per line.
+func WriteHack(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		if _, err := fmt.Fprintf(bw, "%016b\n", word); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteBinary writes words as packed big-endian 16-bit values.
+func WriteBinary(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.BigEndian, words); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// intelHexRecordWords is the number of words in an Intel HEX data record.
+const intelHexRecordWords = 8
+
+// WriteIntelHex writes words as Intel HEX data records. Addresses are byte
+// addresses and each word is stored big-endian, so ROM[n] is at 2n. The 32K
+// word ROM fits in 16-bit addresses without extended records.
+func WriteIntelHex(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	for i := 0; i < len(words); i += intelHexRecordWords {
+		end := i + intelHexRecordWords
+		if end > len(words) {
+			end = len(words)
+		}
+
+		data := make([]byte, 0, 2*intelHexRecordWords)
+		for _, word := range words[i:end] {
+			data = append(data, byte(word>>8), byte(word))
+		}
+		writeIntelHexRecord(bw, uint16(2*i), 0x00, data)
+	}
+	writeIntelHexRecord(bw, 0, 0x01, nil)
+	return bw.Flush()
+}
+
+func writeIntelHexRecord(w io.Writer, address uint16, recordType byte, data []byte) {
+	record := append([]byte{byte(len(data)), byte(address >> 8), byte(address), recordType}, data...)
+
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	record = append(record, -sum)
+
+	fmt.Fprintf(w, ":%X\n", record)
+}
+
+// WriteMemB writes words for Verilog's $readmemb, one binary word per line.
+func WriteMemB(w io.Writer, words []uint16) error {
+	return writeMem(w, words, "%016b\n", "$readmemb")
+}
+
+// WriteMemH writes words for Verilog's $readmemh, one hex word per line.
+func WriteMemH(w io.Writer, words []uint16) error {
+	return writeMem(w, words, "%04x\n", "$readmemh")
+}
+
+func writeMem(w io.Writer, words []uint16, format string, task string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "// Hack ROM image for %s, %d words\n", task, len(words))
+	for _, word := range words {
+		fmt.Fprintf(bw, format, word)
+	}
+	return bw.Flush()
+}
+
+// logisimLineWords is the number of values on a line of a Logisim image.
+const logisimLineWords = 8
+
+// WriteLogisim writes words as a Logisim "v2.0 raw" memory image. Runs of
+// four or more equal words are written as count*value.
+func WriteLogisim(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "v2.0 raw")
+
+	var values []string
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && words[j] == words[i] {
+			j++
+		}
+
+		if n := j - i; n >= 4 {
+			values = append(values, fmt.Sprintf("%d*%x", n, words[i]))
+		} else {
+			for ; i < j; i++ {
+				values = append(values, fmt.Sprintf("%x", words[i]))
+			}
+		}
+		i = j
+	}
+
+	for i := 0; i < len(values); i += logisimLineWords {
+		end := i + logisimLineWords
+		if end > len(values) {
+			end = len(values)
+		}
+		fmt.Fprintln(bw, strings.Join(values[i:end], " "))
+	}
+	return bw.Flush()
+}
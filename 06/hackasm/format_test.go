@@ -0,0 +1,106 @@
+package hackasm_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func TestFormats(t *testing.T) {
+	words := []uint16{0x0002, 0xEA87}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"hack", "0000000000000010\n1110101010000111\n"},
+		{"bin", "\x00\x02\xEA\x87"},
+		{"ihex", ":040000000002EA8789\n:00000001FF\n"},
+		{"memb", "// Hack ROM image for $readmemb, 2 words\n0000000000000010\n1110101010000111\n"},
+		{"memh", "// Hack ROM image for $readmemh, 2 words\n0002\nea87\n"},
+		{"logisim", "v2.0 raw\n2 ea87\n"},
+	}
+
+	for _, test := range tests {
+		f, ok := hackasm.LookupFormat(test.format)
+		if !ok {
+			t.Fatalf("no format %s", test.format)
+		}
+		var got bytes.Buffer
+		if err := f.Write(&got, words); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.format, got.String(), test.want)
+		}
+	}
+
+	if got, want := strings.Join(hackasm.FormatNames(), " "), "bin hack ihex logisim memb memh"; got != want {
+		t.Errorf("got formats %s, want %s", got, want)
+	}
+}
+
+// TestIntelHexRecords checks that every record sums to 0 with its checksum
+// and that records of 8 words are at consecutive byte addresses.
+func TestIntelHexRecords(t *testing.T) {
+	words := make([]uint16, 20)
+	for i := range words {
+		words[i] = uint16(0x1111 * i)
+	}
+
+	var out bytes.Buffer
+	if err := hackasm.WriteIntelHex(&out, words); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Fields(out.String())
+	wantAddresses := []string{"0000", "0010", "0020", "0000"}
+	wantLengths := []byte{16, 16, 8, 0}
+	if len(lines) != len(wantAddresses) {
+		t.Fatalf("got %d records, want %d:\n%s", len(lines), len(wantAddresses), out.String())
+	}
+	for i, line := range lines {
+		record, err := hex.DecodeString(strings.TrimPrefix(line, ":"))
+		if err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+		var sum byte
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			t.Errorf("%s: checksum is off by %d", line, sum)
+		}
+		if record[0] != wantLengths[i] || line[3:7] != wantAddresses[i] {
+			t.Errorf("%s: want %d bytes at %s", line, wantLengths[i], wantAddresses[i])
+		}
+	}
+	if lines[2] != ":08002000111022213332444388" {
+		t.Errorf("got last data record %s", lines[2])
+	}
+}
+
+func TestLogisimRuns(t *testing.T) {
+	tests := []struct {
+		words []uint16
+		want  string
+	}{
+		{nil, "v2.0 raw\n"},
+		{[]uint16{0, 0, 0, 0, 5, 5, 5, 7}, "v2.0 raw\n4*0 5 5 5 7\n"},
+		{[]uint16{7, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 7}, "v2.0 raw\n7 5*ffff 7\n"},
+		{[]uint16{1, 2, 3, 4, 5, 6, 7, 8, 9, 9, 9, 9, 10}, "v2.0 raw\n1 2 3 4 5 6 7 8\n4*9 a\n"},
+	}
+
+	for _, test := range tests {
+		var got bytes.Buffer
+		if err := hackasm.WriteLogisim(&got, test.words); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.want {
+			t.Errorf("%v: got %q, want %q", test.words, got.String(), test.want)
+		}
+	}
+}
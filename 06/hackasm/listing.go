@@ -0,0 +1,54 @@
+package hackasm
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ListingEntry relates a ROM address to the source line it was assembled
+// from.
+type ListingEntry struct {
+	Address int    `json:"address"`
+	Word    string `json:"word"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Source  string `json:"source"`
+}
+
+type Listing struct {
+	File    string         `json:"file"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+// SymbolMap holds the user-defined symbols of a program: labels with their
+// ROM addresses and variables with their RAM addresses.
+type SymbolMap struct {
+	Labels    map[string]int `json:"labels"`
+	Variables map[string]int `json:"variables"`
+}
+
+// Listing returns the listing of the last successful Assemble call.
+func (a *Assembler) Listing() Listing {
+	return Listing{File: a.Name, Entries: a.listing}
+}
+
+// SymbolMap returns the labels and variables defined while assembling.
+func (a *Assembler) SymbolMap() SymbolMap {
+	return SymbolMap{Labels: a.St.Labels(), Variables: a.St.Variables()}
+}
+
+// WriteJSON writes v as indented JSON. It is meant for Listing and SymbolMap.
+func WriteJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+// ReadJSON decodes a Listing or SymbolMap written by WriteJSON.
+func ReadJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,258 @@
+package hackasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Optimization rules, used as keys of OptimizeReport.Saved.
+const (
+	RulePushPop    = "push/pop pair"
+	RuleReload     = "redundant @ reload"
+	RuleDeadCode   = "dead code after jump"
+	RuleJumpToNext = "jump to next instruction"
+)
+
+var pushPop = []string{"@SP", "A=M", "M=D", "@SP", "M=M+1", "@SP", "AM=M-1", "D=M"}
+
+// OptimizeReport tells how many ROM words the peephole optimizer saved.
+type OptimizeReport struct {
+	Before int
+	After  int
+	Saved  map[string]int
+}
+
+func (r OptimizeReport) String() string {
+	var rules []string
+	for rule := range r.Saved {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	var details []string
+	for _, rule := range rules {
+		details = append(details, fmt.Sprintf("%s: %d", rule, r.Saved[rule]))
+	}
+
+	s := fmt.Sprintf("%d -> %d words, saved %d", r.Before, r.After, r.Before-r.After)
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// optLine is a preprocessed source line together with its parse.
+type optLine struct {
+	line SourceLine
+	ins  Instruction
+	text string // canonical form of A- and C-instructions
+}
+
+func (l optLine) isCode() bool {
+	return l.ins.Type == A || l.ins.Type == C
+}
+
+// Optimize applies peephole optimizations to preprocessed lines:
+//
+//   - a push of D immediately popped back into D is removed
+//   - an @X is removed when A already holds X, or when the next instruction
+//     loads A again
+//   - instructions after an unconditional jump are removed up to the next
+//     label
+//   - a jump to the instruction that follows it is removed
+//
+// Lines that do not parse, directives and anything in a .data section are
+// kept as they are and end the current basic block.
+func Optimize(lines []SourceLine) ([]SourceLine, OptimizeReport) {
+	var code []optLine
+
+	inData := false
+	p := NewParser(lines)
+	for p.Scan() {
+		line := p.current
+		if err := p.Advance(); err != nil {
+			code = append(code, optLine{line: line, ins: Instruction{Type: Directive}})
+			continue
+		}
+		if p.Command == "" {
+			continue
+		}
+
+		ins := p.instruction()
+		if ins.Type == Directive && (p.Command == ".data" || p.Command == ".code") {
+			inData = p.Command == ".data"
+		} else if inData {
+			ins.Type = Directive
+		}
+		code = append(code, optLine{line: line, ins: ins, text: canonical(ins)})
+	}
+
+	report := OptimizeReport{Saved: map[string]int{}}
+	for _, l := range code {
+		if l.isCode() {
+			report.Before++
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range []func([]optLine, map[string]int) ([]optLine, bool){
+			removePushPop, removeJumpToNext, removeDeadCode, removeReloads,
+		} {
+			var ok bool
+			code, ok = rule(code, report.Saved)
+			changed = changed || ok
+		}
+	}
+
+	var out []SourceLine
+	for _, l := range code {
+		if l.isCode() {
+			report.After++
+		}
+		out = append(out, l.line)
+	}
+	return out, report
+}
+
+// canonical returns the instruction with its dest registers in AMD order so
+// that equivalent spellings compare equal.
+func canonical(ins Instruction) string {
+	switch ins.Type {
+	case A:
+		return "@" + ins.Symbol
+	case C:
+		dest := ""
+		for _, r := range "AMD" {
+			if strings.ContainsRune(ins.Dest, r) {
+				dest += string(r)
+			}
+		}
+		s := ins.Comp
+		if dest != "" {
+			s = dest + "=" + s
+		}
+		if ins.Jump != "" {
+			s += ";" + ins.Jump
+		}
+		return s
+	}
+	return ""
+}
+
+func removePushPop(code []optLine, saved map[string]int) ([]optLine, bool) {
+	var out []optLine
+	changed := false
+
+	for i := 0; i < len(code); i++ {
+		if matches(code[i:], pushPop) {
+			// A is left pointing at the stack; only drop the pair when the
+			// next instruction does not depend on it
+			next := i + len(pushPop)
+			if next == len(code) || code[next].ins.Type == A {
+				saved[RulePushPop] += len(pushPop)
+				i = next - 1
+				changed = true
+				continue
+			}
+		}
+		out = append(out, code[i])
+	}
+	return out, changed
+}
+
+func matches(code []optLine, pattern []string) bool {
+	if len(code) < len(pattern) {
+		return false
+	}
+	for i, text := range pattern {
+		if code[i].text != text {
+			return false
+		}
+	}
+	return true
+}
+
+func removeJumpToNext(code []optLine, saved map[string]int) ([]optLine, bool) {
+	var out []optLine
+	changed := false
+
+	for i := 0; i < len(code); i++ {
+		if jumpsToNext(code, i) {
+			saved[RuleJumpToNext] += 2
+			changed = true
+			i++
+			continue
+		}
+		out = append(out, code[i])
+	}
+	return out, changed
+}
+
+// jumpsToNext reports whether code[i] and code[i+1] are @L and a jump
+// without side effects to a label L that directly follows them.
+func jumpsToNext(code []optLine, i int) bool {
+	if i+1 >= len(code) || code[i].ins.Type != A {
+		return false
+	}
+	jump := code[i+1].ins
+	if jump.Type != C || jump.Jump == "" || jump.Dest != "" {
+		return false
+	}
+
+	for j := i + 2; j < len(code) && code[j].ins.Type == L; j++ {
+		if code[j].ins.Symbol == code[i].ins.Symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func removeDeadCode(code []optLine, saved map[string]int) ([]optLine, bool) {
+	var out []optLine
+	changed := false
+
+	dead := false
+	for _, l := range code {
+		if !l.isCode() {
+			dead = false
+		}
+		if dead {
+			saved[RuleDeadCode]++
+			changed = true
+			continue
+		}
+		out = append(out, l)
+		if l.ins.Type == C && l.ins.Jump == "JMP" {
+			dead = true
+		}
+	}
+	return out, changed
+}
+
+func removeReloads(code []optLine, saved map[string]int) ([]optLine, bool) {
+	var out []optLine
+	changed := false
+
+	known := ""
+	for i, l := range code {
+		switch l.ins.Type {
+		case A:
+			if l.text == known || (i+1 < len(code) && code[i+1].ins.Type == A) {
+				saved[RuleReload]++
+				changed = true
+				continue
+			}
+			known = l.text
+		case C:
+			if strings.Contains(l.ins.Dest, "A") {
+				known = ""
+			}
+		default:
+			known = ""
+		}
+		out = append(out, l)
+	}
+	return out, changed
+}
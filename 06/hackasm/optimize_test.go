@@ -0,0 +1,186 @@
+package hackasm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+const push = "@SP\nA=M\nM=D\n@SP\nM=M+1\n"
+const pop = "@SP\nAM=M-1\nD=M\n"
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		want  string
+		saved map[string]int
+	}{
+		{"push/pop pair", "D=M\n" + push + pop + "@R13\nM=D", "D=M\n@R13\nM=D",
+			map[string]int{hackasm.RulePushPop: 8}},
+		{"push/pop pair at the end", "D=M\n" + push + pop, "D=M",
+			map[string]int{hackasm.RulePushPop: 8}},
+		// the pairs below are kept, only the reload of SP in them goes
+		{"push/pop pair not followed by @", push + pop + "M=D", push + "AM=M-1\nD=M\nM=D",
+			map[string]int{hackasm.RuleReload: 1}},
+		{"push/pop pair with a label inside", "@SP\nA=M\nM=D\n(L)\n@SP\nM=M+1\n" + pop + "@R13",
+			"@SP\nA=M\nM=D\n(L)\n@SP\nM=M+1\nAM=M-1\nD=M\n@R13", map[string]int{hackasm.RuleReload: 1}},
+		{"push/pop pair spelled differently", "@SP\nA=M\nM=D\n@SP\nM=M+1\n@SP\nMA=M-1\nD=M\n@R13", "@R13",
+			map[string]int{hackasm.RulePushPop: 8}},
+
+		{"reload", "@x\nD=M\n@x\nM=D+1", "@x\nD=M\nM=D+1",
+			map[string]int{hackasm.RuleReload: 1}},
+		{"reload after a conditional jump", "@x\nD;JGT\n@x\nM=0", "@x\nD;JGT\nM=0",
+			map[string]int{hackasm.RuleReload: 1}},
+		{"reload after A is written", "@x\nA=M\n@x\nM=0", "@x\nA=M\n@x\nM=0",
+			map[string]int{}},
+		{"reload after AM is written", "@x\nAM=M+1\n@x\nM=0", "@x\nAM=M+1\n@x\nM=0",
+			map[string]int{}},
+		{"reload after a label", "@x\nM=0\n(L)\n@x\nM=1", "@x\nM=0\n(L)\n@x\nM=1",
+			map[string]int{}},
+		{"load followed by another load", "@x\n@y\nM=0", "@y\nM=0",
+			map[string]int{hackasm.RuleReload: 1}},
+		{"load followed by a C-instruction", "@x\nM=0\n@y\nM=0", "@x\nM=0\n@y\nM=0",
+			map[string]int{}},
+
+		{"dead code", "@L\n0;JMP\nD=A\nM=D\n(K)\nD=0\n(L)", "@L\n0;JMP\n(K)\nD=0\n(L)",
+			map[string]int{hackasm.RuleDeadCode: 2}},
+		{"code after a label", "@END\n0;JMP\n(L)\nD=A\n(END)\n@END\n0;JMP", "@END\n0;JMP\n(L)\nD=A\n(END)\n@END\n0;JMP",
+			map[string]int{}},
+		{"code after a conditional jump", "@L\nD;JEQ\nD=A\n(L)", "@L\nD;JEQ\nD=A\n(L)",
+			map[string]int{}},
+
+		{"jump to next", "D=M\n@L\nD;JGT\n(L)\nM=D", "D=M\n(L)\nM=D",
+			map[string]int{hackasm.RuleJumpToNext: 2}},
+		{"jump to next over labels", "@L\n0;JMP\n(K)\n(L)\nM=D", "(K)\n(L)\nM=D",
+			map[string]int{hackasm.RuleJumpToNext: 2}},
+		{"jump to next that writes D", "@L\nD=D-1;JGT\n(L)\nM=D", "@L\nD=D-1;JGT\n(L)\nM=D",
+			map[string]int{}},
+		{"jump elsewhere", "@K\nD;JGT\nD=A\n(K)", "@K\nD;JGT\nD=A\n(K)",
+			map[string]int{}},
+
+		{"data section", ".data\n(x)\n.word 1\n.code\n@x\n@x", ".data\n(x)\n.word 1\n.code\n@x",
+			map[string]int{hackasm.RuleReload: 1}},
+		{"unparsable line", "@x\nD=M=A\n@x", "@x\nD=M=A\n@x",
+			map[string]int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, err := hackasm.ReadSource("", strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, report := hackasm.Optimize(lines)
+
+			var got []string
+			for _, line := range out {
+				got = append(got, line.Text)
+			}
+			if strings.Join(got, "\n") != test.want {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), test.want)
+			}
+			if !reflect.DeepEqual(report.Saved, test.saved) {
+				t.Errorf("got saved %v, want %v", report.Saved, test.saved)
+			}
+			if saved := report.Before - report.After; saved != sum(test.saved) {
+				t.Errorf("got %d -> %d words, want %d saved", report.Before, report.After, sum(test.saved))
+			}
+		})
+	}
+}
+
+func sum(saved map[string]int) int {
+	n := 0
+	for _, v := range saved {
+		n += v
+	}
+	return n
+}
+
+// TestOptimizeEquivalence runs programs assembled with and without the
+// optimizer on the Hack computer and compares their memory. The stack above
+// the final SP is not compared: a removed push leaves no value there. The
+// programs make no calls, whose return addresses move with the code.
+func TestOptimizeEquivalence(t *testing.T) {
+	files := []string{"../../04/mult/mult.asm"}
+	for _, pattern := range []string{
+		"../../07/testcases/*/*/*.asm",
+		"../../08/testcases/ProgramFlow/*/*.asm",
+		"../../08/testcases/Optimize/*/*.asm",
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".asm"), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var computers []*emulator.Computer
+			var sizes []int
+			for _, optimize := range []bool{false, true} {
+				a := hackasm.NewAssembler(file)
+				a.Optimize = optimize
+				words, err := a.Assemble(bytes.NewReader(src))
+				if err != nil {
+					t.Fatal(err)
+				}
+				computers = append(computers, run(t, words))
+				sizes = append(sizes, len(words))
+			}
+
+			plain, optimized := computers[0], computers[1]
+			if sizes[1] > sizes[0] {
+				t.Errorf("optimized program has %d words, plain %d", sizes[1], sizes[0])
+			}
+			sp := int(plain.RAM[0])
+			if int(optimized.RAM[0]) != sp {
+				t.Fatalf("SP is %d, want %d", optimized.RAM[0], sp)
+			}
+			for address := range plain.RAM {
+				if sp <= address && address < 2048 {
+					continue
+				}
+				if plain.RAM[address] != optimized.RAM[address] {
+					t.Errorf("RAM[%d] is %d, want %d", address, optimized.RAM[address], plain.RAM[address])
+				}
+			}
+		})
+	}
+}
+
+// run runs words with the memory set up as the test scripts of chapters 07
+// and 08 do until the program halts or leaves its code.
+func run(t *testing.T, words []uint16) *emulator.Computer {
+	c := emulator.New()
+	if err := c.Load(words); err != nil {
+		t.Fatal(err)
+	}
+	// SP, LCL, ARG, THIS and THAT, which mult multiplies as R0 and R1, and
+	// the arguments of BasicLoop and FibonacciSeries
+	for address, value := range map[int]uint16{0: 256, 1: 300, 2: 400, 3: 3000, 4: 3010, 400: 6, 401: 3000} {
+		c.RAM[address] = value
+	}
+
+	for i := 0; i < 1000000 && !c.Halted() && int(c.PC) < len(words); i++ {
+		c.Step()
+	}
+	if !c.Halted() && int(c.PC) < len(words) {
+		t.Fatal("program does not halt")
+	}
+	return c
+}
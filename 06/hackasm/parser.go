@@ -0,0 +1,197 @@
+package hackasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type CommandType int
+
+const (
+	A CommandType = iota
+	C
+	L
+	Directive // .data, .code, .word, .string or .fill
+)
+
+var symbolRegexp = regexp.MustCompile(`^[a-zA-Z_.$:][a-zA-Z0-9_.$:]*$`)
+
+// SourceLine is a line of assembly together with the file and line number
+// it was read from.
+type SourceLine struct {
+	Pos  Pos
+	Text string
+}
+
+// ReadSource splits the source read from r into lines.
+func ReadSource(name string, r io.Reader) ([]SourceLine, error) {
+	var lines []SourceLine
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		pos := Pos{File: name, Line: len(lines) + 1, Column: 1}
+		lines = append(lines, SourceLine{Pos: pos, Text: s.Text()})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+type Parser struct {
+	lines       []SourceLine
+	current     SourceLine
+	Name        string
+	Line        int
+	Text        string // source line without surrounding whitespace
+	Command     string
+	CommandType CommandType
+	Comp        string
+	Dest        string
+	Jump        string
+	Args        string // arguments of a directive
+
+	// 1-based columns of the current command and of its C-instruction fields
+	Column     int
+	CompColumn int
+	DestColumn int
+	JumpColumn int
+	ArgsColumn int
+}
+
+func NewParser(lines []SourceLine) *Parser {
+	return &Parser{lines: lines}
+}
+
+func (p *Parser) Scan() bool {
+	if len(p.lines) == 0 {
+		return false
+	}
+	p.current, p.lines = p.lines[0], p.lines[1:]
+	p.Name = p.current.Pos.File
+	p.Line = p.current.Pos.Line
+	return true
+}
+
+func (p *Parser) pos(column int) Pos {
+	pos := p.current.Pos
+	pos.Column = column
+	return pos
+}
+
+// Advance parses the current line. Blank lines and comments leave Command
+// empty. A malformed line is reported as an *Error and leaves Command empty.
+func (p *Parser) Advance() error {
+	raw := p.current.Text
+	p.Text = strings.TrimSpace(raw)
+	txt := stripComment(raw)
+	indent := len(txt) - len(strings.TrimLeft(txt, " \t"))
+	txt = strings.TrimSpace(txt)
+
+	p.Command = ""
+	p.Column = indent + 1
+	p.Dest = ""
+	p.Comp = ""
+	p.Jump = ""
+	p.Args = ""
+
+	if txt == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(txt, "@") {
+		value := strings.TrimSpace(txt[1:])
+		if value == "" {
+			return &Error{Pos: p.pos(p.Column), Kind: ErrSyntax, Msg: "missing value after '@'"}
+		}
+		p.Command = value
+		p.CommandType = A
+		return nil
+	}
+
+	if strings.HasPrefix(txt, "(") {
+		if !strings.HasSuffix(txt, ")") {
+			return &Error{Pos: p.pos(p.Column), Kind: ErrMalformedLabel, Msg: "missing ')' in " + txt}
+		}
+		label := strings.TrimSpace(txt[1 : len(txt)-1])
+		if !symbolRegexp.MatchString(label) {
+			return &Error{Pos: p.pos(p.Column + 1), Kind: ErrMalformedLabel, Msg: fmt.Sprintf("invalid label name %q", label)}
+		}
+		p.Command = label
+		p.CommandType = L
+		return nil
+	}
+
+	if strings.HasPrefix(txt, ".") {
+		p.Command = txt
+		p.ArgsColumn = p.Column + len(txt)
+		if i := strings.IndexAny(txt, " \t"); i >= 0 {
+			p.Command = txt[:i]
+			p.Args = strings.TrimSpace(txt[i:])
+			p.ArgsColumn = p.Column + i + leadingSpaces(txt[i:])
+		}
+		p.CommandType = Directive
+		return nil
+	}
+
+	if strings.Count(txt, "=") > 1 || strings.Count(txt, ";") > 1 {
+		return &Error{Pos: p.pos(p.Column), Kind: ErrSyntax, Msg: "malformed instruction " + txt}
+	}
+
+	comp, compOffset := txt, 0
+	if i := strings.Index(comp, "="); i >= 0 {
+		p.Dest = strings.TrimSpace(comp[:i])
+		p.DestColumn = p.Column
+		comp, compOffset = comp[i+1:], i+1
+	}
+	if i := strings.Index(comp, ";"); i >= 0 {
+		p.Jump = strings.TrimSpace(comp[i+1:])
+		p.JumpColumn = p.Column + compOffset + i + 1 + leadingSpaces(comp[i+1:])
+		comp = comp[:i]
+	}
+	p.CompColumn = p.Column + compOffset + leadingSpaces(comp)
+	p.Comp = strings.Join(strings.Fields(comp), "")
+
+	p.Command = txt
+	p.CommandType = C
+	return nil
+}
+
+// stripComment removes the comment of a line. A "//" inside a string or
+// character literal, as in .string "http://x", does not start a comment.
+func stripComment(raw string) string {
+	var quote byte
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && strings.HasPrefix(raw[i:], "//"):
+			return raw[:i]
+		}
+	}
+	return raw
+}
+
+func leadingSpaces(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " \t"))
+}
+
+func (p *Parser) Symbol() string {
+	switch p.CommandType {
+	case A:
+		return p.Command
+	case L:
+		return p.Command
+	default:
+		return ""
+	}
+}
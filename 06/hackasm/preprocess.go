@@ -0,0 +1,309 @@
+package hackasm
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxExpansionDepth bounds nested macro expansion so that recursive macros
+// are reported instead of looping forever.
+const maxExpansionDepth = 64
+
+var includeRegexp = regexp.MustCompile(`^#include\s+"([^"]+)"$`)
+var macroRefRegexp = regexp.MustCompile(`%(%?)([a-zA-Z_.$:][a-zA-Z0-9_.$:]*)`)
+
+type macro struct {
+	name   string
+	params []string
+	body   []SourceLine
+}
+
+// Preprocessor expands #include directives and .macro/.endm definitions.
+//
+//	#include "lib.asm"
+//
+//	.macro PUSH value
+//	@%value
+//	D=A
+//	@SP
+//	AM=M+1
+//	A=A-1
+//	M=D
+//	.endm
+//
+// Inside a macro body %name refers to the parameter name and %%label to a
+// label local to each expansion. Each file is included at most once.
+type Preprocessor struct {
+	// Open opens an included file. It defaults to os.Open.
+	Open func(name string) (io.ReadCloser, error)
+
+	macros      map[string]*macro
+	included    map[string]bool
+	including   []string
+	expansionID int
+}
+
+func NewPreprocessor() *Preprocessor {
+	return &Preprocessor{macros: map[string]*macro{}, included: map[string]bool{}}
+}
+
+// Process expands the directives in lines. Diagnostics are added to errs.
+func (pp *Preprocessor) Process(lines []SourceLine, errs *ErrorList) ([]SourceLine, error) {
+	if len(lines) > 0 {
+		pp.included[lines[0].Pos.File] = true
+	}
+	return pp.process(lines, errs)
+}
+
+func (pp *Preprocessor) process(lines []SourceLine, errs *ErrorList) ([]SourceLine, error) {
+	var out []SourceLine
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		txt, column := stripLine(line.Text)
+		pos := line.Pos
+		pos.Column = column
+
+		switch {
+		case strings.HasPrefix(txt, "#include"):
+			included, err := pp.include(txt, pos, errs)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, included...)
+
+		case strings.HasPrefix(txt, ".macro"):
+			end := pp.define(lines[i:], errs)
+			i += end
+
+		case txt == ".endm":
+			errs.Add(pos, ErrMacro, ".endm without .macro")
+
+		default:
+			if m, args, ok := pp.lookup(txt); ok {
+				out = append(out, pp.expand(m, args, pos, 0, errs)...)
+				continue
+			}
+			out = append(out, line)
+		}
+	}
+
+	return out, nil
+}
+
+// stripLine removes the comment and surrounding whitespace of a line and
+// returns the remaining text with its 1-based column.
+func stripLine(raw string) (string, int) {
+	txt := stripComment(raw)
+	return strings.TrimSpace(txt), leadingSpaces(txt) + 1
+}
+
+func (pp *Preprocessor) include(txt string, pos Pos, errs *ErrorList) ([]SourceLine, error) {
+	m := includeRegexp.FindStringSubmatch(txt)
+	if m == nil {
+		errs.Add(pos, ErrInclude, "malformed directive %s", txt)
+		return nil, nil
+	}
+
+	name := m[1]
+	if !filepath.IsAbs(name) && pos.File != "" {
+		name = filepath.Join(filepath.Dir(pos.File), name)
+	}
+
+	for _, f := range pp.including {
+		if f == name {
+			errs.Add(pos, ErrInclude, "%s includes itself", name)
+			return nil, nil
+		}
+	}
+	if pp.included[name] {
+		return nil, nil
+	}
+	pp.included[name] = true
+
+	open := pp.Open
+	if open == nil {
+		open = func(name string) (io.ReadCloser, error) {
+			return os.Open(name)
+		}
+	}
+
+	f, err := open(name)
+	if err != nil {
+		errs.Add(pos, ErrInclude, "%s", err)
+		return nil, nil
+	}
+	defer f.Close()
+
+	lines, err := ReadSource(name, f)
+	if err != nil {
+		return nil, err
+	}
+
+	pp.including = append(pp.including, name)
+	defer func() { pp.including = pp.including[:len(pp.including)-1] }()
+
+	return pp.process(lines, errs)
+}
+
+// define records the macro starting at lines[0] and returns the index of its
+// .endm line.
+func (pp *Preprocessor) define(lines []SourceLine, errs *ErrorList) int {
+	txt, column := stripLine(lines[0].Text)
+	pos := lines[0].Pos
+	pos.Column = column
+
+	fields := strings.Fields(strings.Replace(strings.TrimPrefix(txt, ".macro"), ",", " ", -1))
+	if len(fields) == 0 {
+		errs.Add(pos, ErrMacro, "missing macro name")
+	}
+
+	m := &macro{}
+	if len(fields) > 0 {
+		m.name, m.params = fields[0], fields[1:]
+	}
+
+	for i := 1; i < len(lines); i++ {
+		body, column := stripLine(lines[i].Text)
+		if body == ".endm" {
+			pp.register(m, pos, errs)
+			return i
+		}
+		if strings.HasPrefix(body, ".macro") {
+			bodyPos := lines[i].Pos
+			bodyPos.Column = column
+			errs.Add(bodyPos, ErrMacro, "nested macro definition")
+			continue
+		}
+		m.body = append(m.body, lines[i])
+	}
+
+	errs.Add(pos, ErrMacro, "missing .endm for macro %s", m.name)
+	return len(lines) - 1
+}
+
+func (pp *Preprocessor) register(m *macro, pos Pos, errs *ErrorList) {
+	if m.name == "" {
+		return
+	}
+	if !symbolRegexp.MatchString(m.name) {
+		errs.Add(pos, ErrMacro, "invalid macro name %q", m.name)
+		return
+	}
+	if _, ok := compMap[m.name]; ok {
+		errs.Add(pos, ErrMacro, "macro name %s shadows an instruction", m.name)
+		return
+	}
+	if _, ok := pp.macros[m.name]; ok {
+		errs.Add(pos, ErrMacro, "macro %s already defined", m.name)
+		return
+	}
+	for _, param := range m.params {
+		if !symbolRegexp.MatchString(param) {
+			errs.Add(pos, ErrMacro, "invalid parameter name %q", param)
+			return
+		}
+	}
+	pp.macros[m.name] = m
+}
+
+// lookup reports whether txt is an invocation of a defined macro.
+func (pp *Preprocessor) lookup(txt string) (*macro, []string, bool) {
+	name, rest := txt, ""
+	if i := strings.IndexAny(txt, " \t"); i >= 0 {
+		name, rest = txt[:i], strings.TrimSpace(txt[i:])
+	}
+
+	m, ok := pp.macros[name]
+	if !ok {
+		return nil, nil, false
+	}
+
+	var args []string
+	if rest != "" {
+		for _, arg := range strings.Split(rest, ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+	}
+	return m, args, true
+}
+
+// expand returns the body of macro m invoked at pos with args. Parameters
+// and local labels are only substituted in the code of each line, not in its
+// comment, and the expanded lines tell where m was invoked.
+func (pp *Preprocessor) expand(m *macro, args []string, pos Pos, depth int, errs *ErrorList) []SourceLine {
+	if depth >= maxExpansionDepth {
+		errs.Add(pos, ErrMacro, "macro %s expands recursively", m.name)
+		return nil
+	}
+	if len(args) != len(m.params) {
+		errs.Add(pos, ErrMacro, "macro %s takes %d arguments, but %d given", m.name, len(m.params), len(args))
+		return nil
+	}
+
+	values := map[string]string{}
+	for i, param := range m.params {
+		values[param] = args[i]
+	}
+
+	pp.expansionID++
+	scope := m.name + "." + strconv.Itoa(pp.expansionID)
+
+	expansion := expansionOf(m.name, pos)
+
+	var out []SourceLine
+	for _, line := range m.body {
+		linePos := line.Pos
+		linePos.Expansion = expansion
+
+		code := stripComment(line.Text)
+		comment := line.Text[len(code):]
+		code = macroRefRegexp.ReplaceAllStringFunc(code, func(ref string) string {
+			sub := macroRefRegexp.FindStringSubmatch(ref)
+			if sub[1] == "%" {
+				return scope + "$" + sub[2]
+			}
+			if v, ok := values[sub[2]]; ok {
+				return v
+			}
+			refPos := linePos
+			refPos.Column = strings.Index(line.Text, ref) + 1
+			errs.Add(refPos, ErrMacro, "undefined parameter %s", ref)
+			return ref
+		})
+		txt := code + comment
+
+		stripped, column := stripLine(txt)
+		if inner, innerArgs, ok := pp.lookup(stripped); ok {
+			innerPos := linePos
+			innerPos.Column = column
+			out = append(out, pp.expand(inner, innerArgs, innerPos, depth+1, errs)...)
+			continue
+		}
+		out = append(out, SourceLine{Pos: linePos, Text: txt})
+	}
+	return out
+}
+
+// expansionOf returns the Expansion of the lines of macro name invoked at pos.
+// Of nested invocations only the innermost and the outermost are kept, so
+// that recursive macros do not make endless messages.
+func expansionOf(name string, pos Pos) string {
+	const nested = ", in expansion of "
+
+	outer := pos.Expansion
+	pos.Expansion = ""
+	expansion := name + " at " + pos.String()
+	switch i := strings.LastIndex(outer, nested); {
+	case outer == "":
+		return expansion
+	case i < 0:
+		return expansion + nested + outer
+	default:
+		return expansion + ", ..." + outer[i:]
+	}
+}
@@ -0,0 +1,172 @@
+package hackasm_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+const pushMacro = `.macro PUSH value
+	@%value // 100% of %value
+	D=A
+	@SP
+	AM=M+1
+	A=A-1
+	M=D
+.endm
+`
+
+func TestPreprocess(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"parameters", pushMacro + "PUSH 7", []string{
+			"\t@7 // 100% of %value", "\tD=A", "\t@SP", "\tAM=M+1", "\tA=A-1", "\tM=D",
+		}},
+		{"local labels", ".macro SKIP\n(%%end) // %%end stays\n@%%end\n.endm\nSKIP\nSKIP", []string{
+			"(SKIP.1$end) // %%end stays", "@SKIP.1$end",
+			"(SKIP.2$end) // %%end stays", "@SKIP.2$end",
+		}},
+		{"nested", pushMacro + ".macro TWICE x\nPUSH %x\nPUSH %x\n.endm\nTWICE 3", []string{
+			"\t@3 // 100% of %value", "\tD=A", "\t@SP", "\tAM=M+1", "\tA=A-1", "\tM=D",
+			"\t@3 // 100% of %value", "\tD=A", "\t@SP", "\tAM=M+1", "\tA=A-1", "\tM=D",
+		}},
+		{"percent sign in comment", ".macro Z\nD=A // 50%off\n.endm\nZ", []string{
+			"D=A // 50%off",
+		}},
+		{"quoted comment", ".macro S x\n.string \"%x//\" // %y\n.endm\nS a", []string{
+			".string \"a//\" // %y",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, err := hackasm.ReadSource("Prog.asm", strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var errs hackasm.ErrorList
+			lines, err = hackasm.NewPreprocessor().Process(lines, &errs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := errs.Err(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range lines {
+				got = append(got, line.Text)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPreprocessErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"undefined parameter", ".macro MAC x\n  @%y\n.endm\n\n  MAC 1", []string{
+			"Prog.asm:2:4: macro error: undefined parameter %y (in expansion of MAC at Prog.asm:5:3)",
+			"Prog.asm:2:4: bad expression: unexpected '%' (in expansion of MAC at Prog.asm:5:3)",
+		}},
+		{"error in expanded code", ".macro MAC x\nD=%x\n.endm\nMAC Q", []string{
+			"Prog.asm:2:3: unknown comp: \"Q\" (in expansion of MAC at Prog.asm:4:1)",
+		}},
+		{"nested", ".macro IN x\nD=%x\n.endm\n.macro OUT\n  IN Q\n.endm\nOUT", []string{
+			"Prog.asm:2:3: unknown comp: \"Q\" (in expansion of IN at Prog.asm:5:3, in expansion of OUT at Prog.asm:7:1)",
+		}},
+		{"argument count", ".macro MAC x\n.endm\nMAC 1, 2", []string{
+			"Prog.asm:3:1: macro error: macro MAC takes 1 arguments, but 2 given",
+		}},
+		{"recursion", ".macro MAC\nMAC\n.endm\nMAC", []string{
+			"Prog.asm:2:1: macro error: macro MAC expands recursively (in expansion of MAC at Prog.asm:2:1, ..., in expansion of MAC at Prog.asm:4:1)",
+		}},
+		{"missing .endm", ".macro MAC\nD=A", []string{
+			"Prog.asm:1:1: macro error: missing .endm for macro MAC",
+		}},
+		{".endm without .macro", "  .endm", []string{
+			"Prog.asm:1:3: macro error: .endm without .macro",
+		}},
+		{"nested definition", ".macro MAC\n .macro N\n.endm", []string{
+			"Prog.asm:2:2: macro error: nested macro definition",
+		}},
+		{"duplicate", ".macro MAC\n.endm\n.macro MAC\n.endm", []string{
+			"Prog.asm:3:1: macro error: macro MAC already defined",
+		}},
+		{"shadowed instruction", ".macro D\n.endm", []string{
+			"Prog.asm:1:1: macro error: macro name D shadows an instruction",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := hackasm.NewAssembler("Prog.asm").Assemble(strings.NewReader(test.src))
+			var errs hackasm.ErrorList
+			if !errors.As(err, &errs) {
+				t.Fatalf("got %v, want an ErrorList", err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestInclude(t *testing.T) {
+	files := map[string]string{
+		"lib/push.asm": pushMacro + "#include \"util.asm\"",
+		"lib/util.asm": "(UTIL)",
+		"self.asm":     "#include \"self.asm\"",
+		"loop.asm":     "#include \"self.asm\"",
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		src, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(src)), nil
+	}
+
+	a := hackasm.NewAssembler("main.asm")
+	a.Open = open
+	words, err := a.Assemble(strings.NewReader("#include \"lib/push.asm\"\n#include \"lib/util.asm\"\nPUSH 5\n@UTIL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 7 || words[0] != 5 || words[6] != 0 {
+		t.Errorf("got %v, want PUSH 5 followed by @UTIL at 0", words)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"#include \"loop.asm\"", "self.asm:1:1: include error: self.asm includes itself"},
+		{"#include \"none.asm\"", "main.asm:1:1: include error: file does not exist"},
+		{"#include none.asm", "main.asm:1:1: include error: malformed directive #include none.asm"},
+	}
+	for _, test := range tests {
+		a := hackasm.NewAssembler("main.asm")
+		a.Open = open
+		_, err := a.Assemble(strings.NewReader(test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.src, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package hackasm
+
+import (
+	"fmt"
+)
+
+type SymbolTable struct {
+	table map[string]int
+	ramAddress int
+	labels []string
+	variables []string
+}
+
+var predefinedSymbols = map[string]int{
+	"SP": 0,
+	"LCL": 1,
+	"ARG": 2,
+	"THIS": 3,
+	"THAT": 4,
+	"R0": 0,
+	"R1": 1,
+	"R2": 2,
+	"R3": 3,
+	"R4": 4,
+	"R5": 5,
+	"R6": 6,
+	"R7": 7,
+	"R8": 8,
+	"R9": 9,
+	"R10": 10,
+	"R11": 11,
+	"R12": 12,
+	"R13": 13,
+	"R14": 14,
+	"R15": 15,
+	"SCREEN": 16384,
+	"KBD": 24576,
+}
+
+func NewSymbolTable() *SymbolTable {
+	table := map[string]int{}
+	for symbol, address := range predefinedSymbols {
+		table[symbol] = address
+	}
+	return &SymbolTable{table: table, ramAddress: 16}
+}
+
+func (st *SymbolTable)AddEntry(symbol string, address int) error {
+	if _, ok := st.table[symbol]; ok {
+		return fmt.Errorf("%s already exists", symbol)
+	}
+	st.table[symbol] = address
+	st.labels = append(st.labels, symbol)
+	return nil
+}
+
+func (st *SymbolTable)AddVariable(symbol string) int {
+	if address, ok := st.table[symbol]; ok {
+		return address
+	}
+	st.table[symbol] = st.ramAddress
+	st.ramAddress++
+	st.variables = append(st.variables, symbol)
+
+	return st.ramAddress - 1
+}
+
+// AddData defines symbol at the next free RAM address without reserving it.
+// The words it names are reserved by the Reserve calls that follow.
+func (st *SymbolTable) AddData(symbol string) error {
+	if _, ok := st.table[symbol]; ok {
+		return fmt.Errorf("%s already exists", symbol)
+	}
+	st.table[symbol] = st.ramAddress
+	st.variables = append(st.variables, symbol)
+	return nil
+}
+
+// Reserve allocates size consecutive words of RAM from the same allocator as
+// AddVariable and returns the address of the first one.
+func (st *SymbolTable) Reserve(size int) int {
+	address := st.ramAddress
+	st.ramAddress += size
+	return address
+}
+
+func (st *SymbolTable)GetAddress(symbol string) (int, bool) {
+	address, ok := st.table[symbol]
+	return address, ok
+}
+
+// Labels returns the labels defined with AddEntry and their ROM addresses.
+func (st *SymbolTable) Labels() map[string]int {
+	return st.subset(st.labels)
+}
+
+// Variables returns the variables allocated with AddVariable and their RAM
+// addresses.
+func (st *SymbolTable) Variables() map[string]int {
+	return st.subset(st.variables)
+}
+
+func (st *SymbolTable) subset(symbols []string) map[string]int {
+	r := map[string]int{}
+	for _, symbol := range symbols {
+		r[symbol] = st.table[symbol]
+	}
+	return r
+}
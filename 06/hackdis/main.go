@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
+
+func main() {
+	output := flag.String("o", "-", "output file (\"-\" for stdout)")
+	labels := flag.Bool("labels", false, "reconstruct labels for jump targets")
+	symbols := flag.Bool("symbols", false, "name predefined addresses such as R13, SCREEN and KBD")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-labels] [-symbols] [-o output] [file.hack | -]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	fPath := "-"
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		fPath = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var in io.Reader = os.Stdin
+	if fPath != "-" {
+		file, err := os.Open(fPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	words, err := hackasm.ReadHack(bufio.NewReader(in))
+	if err != nil {
+		log.Fatalf("%s: %s", fPath, err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	opts := hackasm.DisassembleOptions{Labels: *labels, Symbols: *symbols}
+	if err := hackasm.Disassemble(out, words, opts); err != nil {
+		log.Fatal(err)
+	}
+}
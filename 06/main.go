@@ -1,63 +1,203 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
-	"strconv"
+	"path"
 	"strings"
-)
 
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+)
 
 func main() {
-	i := 0
-	p := NewParser("Prog.asm")
-	for p.Scan() {
-		p.Advance()
-		if p.Command == "" {
+	var opts options
+	output := flag.String("o", "", "output file (\"-\" for stdout)")
+	format := flag.String("f", "hack", "output format: "+strings.Join(hackasm.FormatNames(), ", "))
+	flag.BoolVar(&opts.listing, "listing", false, "write a JSON listing of ROM addresses and source lines to <name>.lst.json")
+	flag.BoolVar(&opts.optimize, "O", false, "run the peephole optimizer and report the ROM words saved")
+	flag.BoolVar(&opts.symbols, "symbols", false, "write a JSON map of labels and variables to <name>.sym.json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-o output] [-f format] [-O] [-listing] [-symbols] [file.asm ... | directory | -]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var ok bool
+	opts.format, ok = hackasm.LookupFormat(*format)
+	if !ok {
+		log.Fatalf("unknown output format %q", *format)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	var locs []string
+	for _, fPath := range args {
+		if fPath == "-" {
+			locs = append(locs, fPath)
 			continue
 		}
-		switch p.CommandType {
-		case L:
-			p.St.AddEntry(p.Command, i)
-		default:
-			i++
+
+		fInfo, err := os.Stat(fPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fInfo.IsDir() {
+			fInfos, err := ioutil.ReadDir(fPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			locs = append(locs, pickAsmFileLocations(fInfos, fPath)...)
+		} else {
+			locs = append(locs, fPath)
 		}
 	}
-	p.File.Close()
-	p.reLoadFile("Prog.asm")
 
-	out, _ := os.Create("Prog.hack")
-	defer out.Close()
+	if len(locs) == 0 {
+		log.Fatalf("no .asm files found")
+	}
 
-	for p.Scan() {
-		p.Advance()
-		if p.Command == "" {
-			continue
+	if *output != "" && len(locs) > 1 {
+		log.Fatalf("-o cannot be used with multiple input files")
+	}
+
+	for _, loc := range locs {
+		outPath := *output
+		if outPath == "" {
+			outPath = outputLocation(loc, opts.format)
+		}
+
+		if err := generate(loc, outPath, opts); err != nil {
+			report(err)
+		}
+	}
+}
+
+// report prints err to stderr, one line per diagnostic, and exits.
+func report(err error) {
+	if errs, ok := err.(hackasm.ErrorList); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		os.Exit(1)
+	}
+	log.Fatal(err)
+}
+
+func pickAsmFileLocations(fInfos []os.FileInfo, fPath string) (locs []string) {
+	for _, f := range fInfos {
+		name := f.Name()
+		if strings.HasSuffix(name, ".asm") && !f.IsDir() {
+			locs = append(locs, path.Join(fPath, name))
+		}
+	}
+	return locs
+}
+
+func outputLocation(loc string, format hackasm.Format) string {
+	if loc == "-" {
+		return "-"
+	}
+	return strings.TrimSuffix(loc, ".asm") + format.Extension
+}
+
+type options struct {
+	format   hackasm.Format
+	optimize bool
+	listing  bool
+	symbols  bool
+}
+
+func generate(loc string, outPath string, opts options) error {
+	var src []byte
+	var err error
+	name := loc
+	if loc == "-" {
+		name = ""
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(loc)
+	}
+	if err != nil {
+		return err
+	}
+
+	a := hackasm.NewAssembler(name)
+	a.Optimize = opts.optimize
+	words, err := a.Assemble(bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+
+	if opts.optimize {
+		if name == "" {
+			name = "<stdin>"
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, a.OptimizeReport())
+	}
+
+	if opts.listing || opts.symbols {
+		base, err := debugFileBase(loc, outPath)
+		if err != nil {
+			return err
 		}
-		switch p.CommandType {
-		case A:
-			intToCmd := func(v int) string {
-				cmd := []string{"0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0"}
-				for i := len(cmd) - 1; i >= 0; i-- {
-					cmd[i] = strconv.Itoa(v & 1)
-					v >>= 1
-				}
-				return strings.Join(cmd, "")
+		if opts.listing {
+			if err := writeJSONFile(base+".lst.json", a.Listing()); err != nil {
+				return err
 			}
-			value, err := strconv.Atoi(p.Command)
-			if err != nil {
-				if v, ok := p.St.GetAddress(p.Command); ok {
-					value = v
-				} else {
-					value = p.St.AddVariable(p.Command)
-				}
+		}
+		if opts.symbols {
+			if err := writeJSONFile(base+".sym.json", a.SymbolMap()); err != nil {
+				return err
 			}
-			out.WriteString(intToCmd(value) + "\n")
-		case C:
-			cmd := "111" + Comp(p.Comp) + Dest(p.Dest) + Jump(p.Jump)
-			out.WriteString(cmd + "\n")
-		default:
-			break
 		}
 	}
-	p.File.Close()
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := opts.format.Write(buf, words); err != nil {
+		return err
+	}
+
+	if outPath == "-" {
+		_, err := buf.WriteTo(os.Stdout)
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = buf.WriteTo(out)
+	return err
+}
+
+// debugFileBase returns the path, without extension, next to which the
+// listing and symbol files are written.
+func debugFileBase(loc string, outPath string) (string, error) {
+	if outPath != "-" {
+		return strings.TrimSuffix(outPath, path.Ext(outPath)), nil
+	}
+	if loc != "-" {
+		return strings.TrimSuffix(loc, ".asm"), nil
+	}
+	return "", fmt.Errorf("-listing and -symbols need an input or output file name")
+}
+
+func writeJSONFile(fPath string, v interface{}) error {
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return hackasm.WriteJSON(out, v)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/tst"
+)
+
+// TestTestcases translates the programs of the tests of this chapter and
+// runs their test scripts on the Hack computer. 08/vm runs them too; this
+// keeps the translator of this chapter checked on its own.
+func TestTestcases(t *testing.T) {
+	scripts, err := filepath.Glob("testcases/*/*/*.tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no test scripts found")
+	}
+
+	for _, script := range scripts {
+		script := script
+		name := strings.TrimSuffix(filepath.Base(script), ".tst")
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := translate(filepath.Dir(script), filepath.Join(dir, name+".asm")); err != nil {
+				t.Fatal(err)
+			}
+			for _, ext := range []string{".tst", ".cmp"} {
+				src, err := os.ReadFile(strings.TrimSuffix(script, ".tst") + ext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, name+ext), src, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := tst.RunFile(filepath.Join(dir, name+".tst"))
+			var cmpErr *tst.CompareError
+			if errors.As(err, &cmpErr) {
+				t.Fatalf("output differs from %s.cmp: %s", name, err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// translate translates the .vm files of dir into the assembly file out, as
+// main does for a directory.
+func translate(dir string, out string) error {
+	locs, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return err
+	}
+
+	asm := bytes.NewBuffer([]byte{})
+	for _, loc := range locs {
+		file, err := os.Open(loc)
+		if err != nil {
+			return err
+		}
+		cmds, err := NewParser(file).Parse()
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(loc), ".vm")
+		if err := NewCodeWriter(cmds, asm, name).GenerateCode(); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(out, asm.Bytes(), 0644)
+}
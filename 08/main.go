@@ -1,90 +1,124 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"strings"
+
+	"github.com/ebakazu/nand2tetris/08/vm"
 )
 
 func main() {
-	args := os.Args
-	if len(args) < 2 {
+	osDir := flag.String("os", "", "directory of OS .vm files to link with the program; classes the program defines are not linked")
+	shared := flag.Bool("shared", false, "write calls, returns and comparisons as jumps to shared routines and report the ROM words saved")
+	optimize := flag.Bool("O", false, "fuse common sequences of VM commands into shorter code and report the ROM words saved")
+	prune := flag.Bool("prune", false, "leave out the functions Sys.init never calls and report the ROM words saved")
+	sourceMap := flag.Bool("map", false, "precede the code of each command with its position and write a source map to <name>.map.json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-os directory] [-shared] [-O] [-prune] [-map] file.vm | directory\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatalf("missing file or directory argument")
 	}
 
-	fPath := args[1]
+	fPath := flag.Arg(0)
 
 	fInfo, err := os.Stat(fPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// a directory is a whole program, which starts at Sys.init; a single
+	// file is translated as is, unless it is linked with the OS
+	var outPath string
+	var locs []string
+	bootstrap := false
 	if fInfo.IsDir() {
-		out, err := os.Create(path.Join(fPath, path.Base(fPath) + ".asm"))
-		defer out.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-
 		fInfos, err := ioutil.ReadDir(fPath)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		locs := pickVMFileLocations(fInfos, fPath)
-		for i, loc := range locs {
-			file, err := os.Open(loc)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			p := NewParser(file)
-			cmds, err := p.Parse()
-			file.Close()
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			trimmedName := strings.TrimSuffix(path.Base(file.Name()), ".vm")
-			writer := NewCodeWriter(cmds, out, trimmedName)
-			if i == 0 {
-				if err := writer.BootstrapCode(); err != nil {
-					log.Fatal(err)
-				}
-			}
-			err = writer.GenerateCode()
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+		outPath = path.Join(fPath, path.Base(fPath)+".asm")
+		locs = pickVMFileLocations(fInfos, fPath)
+		bootstrap = true
 	} else {
-		trimmedName := strings.TrimSuffix(fPath, ".vm")
-		out, err := os.Create(trimmedName + ".asm")
-		defer out.Close()
+		outPath = strings.TrimSuffix(fPath, ".vm") + ".asm"
+		locs = []string{fPath}
+	}
+
+	if *osDir != "" {
+		fInfos, err := ioutil.ReadDir(*osDir)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		file, err := os.Open(fPath)
-		defer file.Close()
+		locs = append(locs, pickOSFileLocations(fInfos, *osDir, locs)...)
+		bootstrap = true
+	}
+
+	var files []vm.File
+	for _, loc := range locs {
+		file, err := os.Open(loc)
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer file.Close()
 
-		p := NewParser(file)
-		cmds, err := p.Parse()
-		if err != nil {
+		files = append(files, vm.File{Name: strings.TrimSuffix(path.Base(loc), ".vm"), Src: file})
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	opts := vm.Options{Bootstrap: bootstrap, SharedRoutines: *shared, Optimize: *optimize, RemoveUnused: *prune}
+	if *sourceMap {
+		opts.SourceMap = &vm.SourceMap{}
+	}
+	size, err := vm.Translate(out, files, opts)
+	if err != nil {
+		report(err)
+	}
+	if *shared || *optimize || *prune {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", outPath, size)
+	}
+
+	if opts.SourceMap != nil {
+		if err := writeSourceMap(strings.TrimSuffix(outPath, ".asm")+".map.json", opts.SourceMap); err != nil {
 			log.Fatal(err)
 		}
+	}
+}
 
-		writer := NewCodeWriter(cmds, out, trimmedName)
-		err = writer.GenerateCode()
-		if err != nil {
-			log.Fatal(err)
+func writeSourceMap(fPath string, m *vm.SourceMap) error {
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return m.WriteJSON(out)
+}
+
+// report prints err to stderr, one line per error, and exits.
+func report(err error) {
+	if errs, ok := err.(vm.ErrorList); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
 		}
+		os.Exit(1)
 	}
+	log.Fatal(err)
 }
 
 func pickVMFileLocations(fInfos []os.FileInfo, fPath string) (locs []string) {
@@ -96,3 +130,18 @@ func pickVMFileLocations(fInfos []os.FileInfo, fPath string) (locs []string) {
 	}
 	return locs
 }
+
+// pickOSFileLocations picks the .vm files of the OS directory whose class is
+// not among the program's files, so the program can replace OS classes.
+func pickOSFileLocations(fInfos []os.FileInfo, fPath string, programLocs []string) (locs []string) {
+	defined := map[string]bool{}
+	for _, loc := range programLocs {
+		defined[path.Base(loc)] = true
+	}
+	for _, loc := range pickVMFileLocations(fInfos, fPath) {
+		if !defined[path.Base(loc)] {
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
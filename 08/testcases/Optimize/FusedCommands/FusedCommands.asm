@@ -0,0 +1,402 @@
+@5000
+D=A
+@4
+M=D
+@7
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@SP
+A=M-1
+M=M+1
+@SP
+A=M-1
+M=M-1
+@3
+D=A
+@SP
+A=M-1
+M=M-D
+@SP
+AM=M-1
+D=M
+@THAT
+A=M
+M=D
+@12
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@10
+D=A
+@SP
+A=M-1
+M=D&M
+@1
+D=A
+@SP
+A=M-1
+M=D|M
+@SP
+AM=M-1
+D=M
+@THAT
+A=M+1
+M=D
+@ARG
+A=M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@2
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+A=M-1
+D=M-D
+M=-1
+@END0
+D;JLT
+@SP
+A=M-1
+M=0
+(END0)
+@THAT
+D=M
+@2
+D=D+A
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@R13
+A=M
+M=D
+@ARG
+A=M+1
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@5
+D=A
+@SP
+A=M-1
+D=M-D
+M=-1
+@END1
+D;JEQ
+@SP
+A=M-1
+M=0
+(END1)
+@THAT
+D=M
+@3
+D=D+A
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@R13
+A=M
+M=D
+@ARG
+A=M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@ARG
+A=M+1
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@2
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+A=M-1
+M=D+M
+@SP
+AM=M-1
+D=M
+@SP
+AM=M-1
+D=M-D
+@$GT_TAKEN
+D;JGT
+@THAT
+D=M
+@4
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($GT_TAKEN)
+@ARG
+A=M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@ARG
+A=M+1
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@2
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+A=M-1
+M=D+M
+@SP
+AM=M-1
+D=M
+@SP
+AM=M-1
+D=M-D
+@$NOT_LT_TAKEN
+D;JGE
+@THAT
+D=M
+@5
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($NOT_LT_TAKEN)
+@ARG
+A=M+1
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@SP
+AM=M-1
+D=!M
+@$NOT_TAKEN
+D;JNE
+@THAT
+D=M
+@6
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($NOT_TAKEN)
+@LCL
+A=M
+D=M
+@$PUSH_TAKEN
+D;JNE
+@THAT
+D=M
+@7
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($PUSH_TAKEN)
+@ARG
+A=M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@30
+D=A
+@SP
+AM=M-1
+D=M-D
+@$NE_TAKEN
+D;JNE
+@THAT
+D=M
+@8
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($NE_TAKEN)
+@ARG
+A=M+1
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@2
+D=A
+@ARG
+A=D+M
+D=M
+@SP
+AM=M-1
+D=M-D
+@$LT_TAKEN
+D;JLT
+@THAT
+D=M
+@9
+D=D+A
+@R13
+M=D
+@1
+D=A
+@R13
+A=M
+M=D
+($LT_TAKEN)
+@2
+D=A
+@ARG
+A=D+M
+D=M
+@LCL
+A=M+1
+M=D
+@LCL
+D=M
+@5
+D=D+A
+@R13
+M=D
+@LCL
+A=M+1
+D=M
+@R13
+A=M
+M=D
+@5
+D=A
+@LCL
+A=D+M
+D=M
+@FusedCommands.3
+M=D
+@FusedCommands.3
+D=M
+@7
+M=D
+@7
+D=M
+@THIS
+A=M
+M=D
+@THIS
+A=M
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@SP
+A=M-1
+M=M+1
+@THAT
+D=M
+@10
+D=D+A
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@R13
+A=M
+M=D
+@THAT
+D=M
+@11
+D=D+A
+@R13
+M=D
+@3
+D=M
+@R13
+A=M
+M=D
+@7
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
+@20
+D=A
+@SP
+A=M-1
+M=M-D
+@THAT
+D=M
+@12
+D=D+A
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@R13
+A=M
+M=D
+($END)
+@$END
+0;JMP
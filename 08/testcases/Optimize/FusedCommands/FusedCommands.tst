@@ -0,0 +1,24 @@
+// Tests FusedCommands.asm, the optimized translation of FusedCommands.vm.
+
+load FusedCommands.asm,
+output-file FusedCommands.out,
+compare-to FusedCommands.cmp,
+output-list RAM[0]%D2.6.2 RAM[5000]%D2.6.2 RAM[5001]%D2.6.2 RAM[5002]%D2.6.2
+            RAM[5003]%D2.6.2 RAM[5004]%D2.6.2 RAM[5005]%D2.6.2 RAM[5006]%D2.6.2
+            RAM[5007]%D2.6.2 RAM[5008]%D2.6.2 RAM[5009]%D2.6.2 RAM[5010]%D2.6.2
+            RAM[5011]%D2.6.2 RAM[5012]%D2.6.2 RAM[305]%D2.6.2 RAM[3000]%D2.6.2;
+
+set RAM[0] 256,
+set RAM[1] 300,
+set RAM[2] 400,
+set RAM[3] 3000,
+set RAM[4] 3010,
+set RAM[400] 30,
+set RAM[401] 5,
+set RAM[402] 17,
+
+repeat 1000 {
+  ticktock;
+}
+
+output;
@@ -0,0 +1,451 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CodeWriter writes the assembly code of the files of one program. Its
+// counter numbers the labels it generates, so the output only depends on
+// the commands written, and the files of a program must share one writer.
+type CodeWriter struct{
+	writer io.Writer
+	name string
+	currentFunctionName string
+	labelCnt int
+	words int
+	lines int
+
+	// SharedRoutines makes calls, returns and comparisons jump to routines
+	// written once by WriteSharedRoutines instead of inlining their code.
+	SharedRoutines bool
+	usedRoutines map[string]bool
+
+	// Optimize fuses sequences of commands, see writeFused.
+	Optimize bool
+	saved map[string]int
+
+	// SourceMap, if not nil, receives the lines of the code of each command,
+	// and the code is preceded by a comment with the command, see
+	// writeSource.
+	SourceMap *SourceMap
+}
+
+// The shared routines, in the order WriteSharedRoutines writes them.
+const (
+	routineCall = "$$call"
+	routineReturn = "$$return"
+	routineEq = "$$eq"
+	routineGt = "$$gt"
+	routineLt = "$$lt"
+)
+
+var sharedRoutines = []string{routineCall, routineReturn, routineEq, routineGt, routineLt}
+
+var labelRegexp = regexp.MustCompile(`^[a-zA-Z_.:][a-zA-Z0-9_.:]*$`)
+
+func NewCodeWriter(writer io.Writer) *CodeWriter {
+	return &CodeWriter{writer: writer, name: "", currentFunctionName: "", labelCnt: 0, usedRoutines: map[string]bool{}, saved: map[string]int{}}
+}
+
+// Words returns the number of instructions, that is of ROM words, written
+// so far.
+func (cw *CodeWriter) Words() int {
+	return cw.words
+}
+
+// SetFileName starts the translation of a new file, whose name without the
+// .vm extension qualifies its static variables. Labels before the first
+// function of the file are not in a function, as when each file had its own
+// writer.
+func (cw *CodeWriter) SetFileName(name string) {
+	cw.name = name
+	cw.currentFunctionName = ""
+}
+
+func (cw *CodeWriter)BootstrapCode() error {
+	cw.fPrintln("@256\nD=A\n@SP\nM=D")
+	if err := cw.writeCall("Sys.init", 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cw *CodeWriter)GenerateCode(commands []Command) error {
+	for i := 0; i < len(commands); i++ {
+		if cw.Optimize {
+			n, err := cw.writeFused(commands[i:])
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				i += n - 1
+				continue
+			}
+		}
+
+		c := commands[i]
+		if err := cw.writeSource(commands[i:i+1], func() error { return cw.writeCommand(c) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *CodeWriter)writeCommand(c Command) error {
+	switch c.CommandType {
+	case CArithmetic:
+		if err := cw.writeArithmetic(c.Name); err != nil {
+			return err
+		}
+	case CPush:
+		if err := cw.writePush(c.Arg1, c.Arg2); err != nil {
+			return err
+		}
+	case CPop:
+		if err := cw.writePop(c.Arg1, c.Arg2); err != nil {
+			return err
+		}
+	case CLabel:
+		if err := cw.writeLabel(c.Arg1); err != nil {
+			return err
+		}
+	case CGoto:
+		if err := cw.writeGoto(c.Arg1); err != nil {
+			return err
+		}
+	case CIfGoto:
+		if err := cw.writeIfGoto(c.Arg1); err != nil {
+			return err
+		}
+	case CFunction:
+		cw.currentFunctionName = c.Arg1
+		if err := cw.writeFunction(c.Arg1, c.Arg2); err != nil {
+			return err
+		}
+	case CReturn:
+		if err := cw.writeReturn(); err != nil {
+			return err
+		}
+	case CCall:
+		if err := cw.writeCall(c.Arg1, c.Arg2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *CodeWriter)fPrintln(a string) {
+	for _, line := range strings.Split(a, "\n") {
+		cw.lines++
+		if line != "" && !strings.HasPrefix(line, "(") && !strings.HasPrefix(line, "//") {
+			cw.words++
+		}
+	}
+	fmt.Fprintln(cw.writer, a)
+}
+
+func (cw *CodeWriter)push() string {
+	return "@SP\nA=M\nM=D\n@SP\nM=M+1"
+}
+
+func (cw *CodeWriter)writePush(segment string, index int) error {
+	var code []string
+
+	// load index into D register
+	loadIndex := func() []string {
+		return []string{"@" + strconv.Itoa(index), "D=A"}
+	}
+
+	// load segment[index] into D register
+	loadMemData := func(base string) []string {
+		return append(loadIndex(),  []string{"@" + base, "A=D+M", "D=M"}...)
+	}
+
+	switch segment {
+	case "constant":
+		code = loadIndex()
+	case "argument":
+		code = loadMemData("ARG")
+	case "local":
+		code = loadMemData("LCL")
+	case "this":
+		code = loadMemData("THIS")
+	case "that":
+		code = loadMemData("THAT")
+	case "pointer":
+		code = append(loadIndex(), []string{"@R3", "A=D+A", "D=M"}...)
+	case "temp":
+		code = append(loadIndex(), []string{"@R5", "A=D+A", "D=M"}...)
+	case "static":
+		code = []string{"@" + cw.name + "." + strconv.Itoa(index), "D=M"}
+	default:
+		return fmt.Errorf("undefined segment: %s", segment)
+	}
+	code = append(code, cw.push())
+
+	cw.fPrintln(strings.Join(code, "\n"))
+	return nil
+}
+
+func (cw *CodeWriter)pop() string {
+	return "@SP\nAM=M-1\nD=M"
+}
+
+func (cw *CodeWriter)writePop(segment string, index int) error {
+	var code []string
+
+	pop := func(base string) []string {
+		return []string{"@" + base, "D=M", "@" + strconv.Itoa(index), "D=D+A", "@R13", "M=D", cw.pop(), "@R13", "A=M", "M=D"}
+	}
+
+	switch segment {
+	case "constant":
+		return fmt.Errorf("cannot pop to the constant segment")
+	case "argument":
+		code = pop("ARG")
+	case "local":
+		code = pop("LCL")
+	case "this":
+		code = pop("THIS")
+	case "that":
+		code = pop("THAT")
+	case "pointer":
+		code = []string{"@R3", "D=A", "@" + strconv.Itoa(index), "D=D+A", "@R13", "M=D", cw.pop(), "@R13", "A=M", "M=D"}
+	case "temp":
+		code = []string{"@R5", "D=A", "@" + strconv.Itoa(index), "D=D+A", "@R13", "M=D", cw.pop(), "@R13", "A=M", "M=D"}
+	case "static":
+		code = []string{cw.pop(), "@" + cw.name + "." + strconv.Itoa(index), "M=D"}
+	default:
+		return fmt.Errorf("undefined segment: %s", segment)
+	}
+	cw.fPrintln(strings.Join(code, "\n"))
+
+	return nil
+}
+
+func (cw *CodeWriter)writeArithmetic(command string) error {
+	unary := func(ope string) string {
+		return strings.Join([]string{"@SP", "A=M-1", ope}, "\n")
+	}
+
+	binary := func(ope string) string {
+		return strings.Join([]string{cw.pop(), "A=A-1", ope}, "\n")
+	}
+
+	relational := func(ope string, routine string) string {
+		if cw.SharedRoutines {
+			return cw.callRoutine(routine)
+		}
+
+		label := strconv.Itoa(cw.labelCnt)
+		cw.labelCnt++
+		code := []string{
+			binary("M=M-D"), // x - y
+
+			"D=M",
+			"@TRUE" + label,
+			"D;" + ope, // if (x - y operator 0) goto TRUE else goto FALSE
+			"@FALSE" + label,
+			"0;JMP",
+
+			"(TRUE" + label + ")",
+			"D=-1",
+			"@END" + label,
+			"0;JMP",
+
+			"(FALSE" + label + ")",
+			"D=0",
+
+			"(END" + label + ")",
+			"@SP",
+			"A=M-1",
+			"M=D",
+		}
+		return strings.Join(code, "\n")
+	}
+
+	switch command{
+	case "add": // x + y
+		cw.fPrintln(binary("M=D+M"))
+	case "sub": // x - y
+		cw.fPrintln(binary("M=M-D"))
+	case "neg": // -y
+		cw.fPrintln(unary("M=-M"))
+	case "eq": // if x == y return true else return false
+		cw.fPrintln(relational("JEQ", routineEq))
+	case "gt": // if x > y return true else return false
+		cw.fPrintln(relational("JGT", routineGt))
+	case "lt": // if x < y return true else return false
+		cw.fPrintln(relational("JLT", routineLt))
+	case "and": // x & y
+		cw.fPrintln(binary("M=D&M"))
+	case "or": // x || y
+		cw.fPrintln(binary("M=D|M"))
+	case "not":	// !y
+		cw.fPrintln(unary("M=!M"))
+	default:
+		return fmt.Errorf("unknown arithmetic command: %s", command)
+	}
+	return nil
+}
+
+func (cw *CodeWriter)validateLabelName(name string) bool {
+	return labelRegexp.MatchString(name)
+}
+
+func (cw *CodeWriter)generateLabel(dest string) string {
+	return cw.currentFunctionName + "$" + dest
+}
+
+func (cw *CodeWriter)writeLabel(dest string) error {
+	if ok := cw.validateLabelName(dest); !ok {
+		return fmt.Errorf("invalid label name: %s", dest)
+	}
+
+	cw.fPrintln("(" + cw.generateLabel(dest) + ")")
+	return nil
+}
+
+func (cw *CodeWriter)writeGoto(dest string) error {
+	if ok := cw.validateLabelName(dest); !ok {
+		return fmt.Errorf("invalid label name: %s", dest)
+	}
+	cw.fPrintln(strings.Join([]string{"@" + cw.generateLabel(dest), "0;JMP"}, "\n"))
+	return nil
+}
+
+func (cw *CodeWriter)writeIfGoto(dest string) error {
+	if ok := cw.validateLabelName(dest); !ok {
+		return fmt.Errorf("invalid label name: %s", dest)
+	}
+
+	cw.fPrintln(strings.Join([]string{"@SP", "AM=M-1", "D=M", "@" + cw.generateLabel(dest), "D;JNE"}, "\n"))
+	return nil
+}
+
+func (cw *CodeWriter)writeFunction(f string, k int) error {
+	cw.fPrintln("(" + f + ")")
+	for i := 0; i < k; i++ {
+		cw.fPrintln(strings.Join([]string{"@0", "D=A", cw.push()}, "\n"))
+	}
+	return nil
+}
+
+func (cw *CodeWriter)writeReturn() error {
+	if cw.SharedRoutines {
+		cw.usedRoutines[routineReturn] = true
+		cw.fPrintln("@" + routineReturn + "\n0;JMP")
+		return nil
+	}
+	cw.fPrintln(strings.Join(cw.returnCode(), "\n"))
+	return nil
+}
+
+func (cw *CodeWriter)returnCode() []string {
+	return []string{
+		"@LCL", "D=M", "@R13", "M=D",  // tmp = LCL
+		"@5", "D=D-A", "A=D", "D=M", "@R14", "M=D", // RET = *(tmp - 5)
+		cw.pop(), "@ARG", "A=M", "M=D", // *ARG = pop()
+		"@ARG", "D=M", "@SP", "M=D+1", // SP = ARG + 1
+		"@R13", "AM=M-1", "D=M", "@THAT", "M=D", // THAT = *(tmp - 1)
+		"@R13", "AM=M-1", "D=M", "@THIS", "M=D", // THIS = *(tmp - 2)
+		"@R13", "AM=M-1", "D=M", "@ARG", "M=D", // ARG = *(tmp - 3)
+		"@R13", "AM=M-1", "D=M", "@LCL", "M=D", // LCL = *(tmp - 4)
+		"@R14", "A=M", "0;JMP", // goto RET
+	}
+}
+
+func (cw *CodeWriter)writeCall(f string, n int) error {
+	if cw.SharedRoutines {
+		setArgs := []string{"@" + strconv.Itoa(n), "D=A", "@R14", "M=D"}
+		if n == 0 {
+			setArgs = []string{"@R14", "M=0"}
+		}
+		cw.fPrintln(cw.callRoutine(routineCall, append(setArgs, "@" + f, "D=A")...))
+		return nil
+	}
+
+	returnAddress := "call" + strconv.Itoa(cw.labelCnt)
+	cw.labelCnt++
+	code := []string{
+		"@" + returnAddress, "D=A", cw.push(),
+		"@LCL", "D=M", cw.push(),
+		"@ARG", "D=M", cw.push(),
+		"@THIS", "D=M", cw.push(),
+		"@THAT", "D=M", cw.push(),
+		"@SP", "D=M", "@" + strconv.Itoa(n), "D=D-A", "@5", "D=D-A", "@ARG", "M=D",
+		"@SP", "D=M", "@LCL", "M=D",
+		"@" + f, "0;JMP",
+		"(" + returnAddress + ")",
+	}
+	cw.fPrintln(strings.Join(code, "\n"))
+	return nil
+}
+
+// callRoutine jumps to a shared routine with the return address in R13,
+// after running setup.
+func (cw *CodeWriter)callRoutine(routine string, setup ...string) string {
+	returnAddress := "call" + strconv.Itoa(cw.labelCnt)
+	cw.labelCnt++
+	cw.usedRoutines[routine] = true
+
+	code := append([]string{"@" + returnAddress, "D=A", "@R13", "M=D"}, setup...)
+	code = append(code, "@" + routine, "0;JMP", "(" + returnAddress + ")")
+	return strings.Join(code, "\n")
+}
+
+// WriteSharedRoutines writes the shared routines used so far, after the
+// last file of the program. They start with a loop that stops a program
+// running past its last command from running into them.
+//
+// $$call expects the return address in R13, the number of arguments in R14
+// and the address of the function in D. $$return is the inline code of
+// return. $$eq, $$gt and $$lt compare the two topmost values of the stack
+// and return to the address in R13.
+func (cw *CodeWriter)WriteSharedRoutines() {
+	if len(cw.usedRoutines) == 0 {
+		return
+	}
+	cw.fPrintln("($$halt)\n@$$halt\n0;JMP")
+
+	for _, routine := range sharedRoutines {
+		if !cw.usedRoutines[routine] {
+			continue
+		}
+
+		var code []string
+		switch routine {
+		case routineCall:
+			code = []string{
+				"@R15", "M=D", // R15 = function
+				"@R13", "D=M", cw.push(),
+				"@LCL", "D=M", cw.push(),
+				"@ARG", "D=M", cw.push(),
+				"@THIS", "D=M", cw.push(),
+				"@THAT", "D=M", cw.push(),
+				"@SP", "D=M", "@R14", "D=D-M", "@5", "D=D-A", "@ARG", "M=D", // ARG = SP - n - 5
+				"@SP", "D=M", "@LCL", "M=D", // LCL = SP
+				"@R15", "A=M", "0;JMP",
+			}
+		case routineReturn:
+			code = cw.returnCode()
+		case routineEq, routineGt, routineLt:
+			done := routine + ".done"
+			code = []string{
+				cw.pop(), "A=A-1", "D=M-D", // x - y
+				"M=-1", // true unless the jump below is not taken
+				"@" + done,
+				"D;J" + strings.ToUpper(strings.TrimPrefix(routine, "$$")),
+				"@SP", "A=M-1", "M=0",
+				"(" + done + ")",
+				"@R13", "A=M", "0;JMP",
+			}
+		}
+		cw.fPrintln("(" + routine + ")")
+		cw.fPrintln(strings.Join(code, "\n"))
+	}
+}
@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoSysInit is returned by Translate for a program that is bootstrapped
+// but does not define Sys.init.
+var ErrNoSysInit = errors.New("the program has no Sys.init to start from")
+
+// Pos is the position of a command: its file and its line, starting at 1.
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList collects every error found in a program, in program order, so
+// that they can be reported at once.
+type ErrorList []*Error
+
+func (l *ErrorList) Add(pos Pos, format string, a ...interface{}) {
+	*l = append(*l, &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil if the list is empty, otherwise the list.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
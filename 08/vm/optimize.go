@@ -0,0 +1,259 @@
+package vm
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Optimization rules, used as keys of SizeReport.Saved.
+const (
+	RuleCompareJump    = "compare and if-goto"
+	RuleNotJump        = "not and if-goto"
+	RulePushArithmetic = "push and arithmetic"
+	RulePushCompare    = "push, compare and if-goto"
+	RulePushPop        = "push and pop"
+	RulePushJump       = "push and if-goto"
+	RulePush           = "push"
+	RulePop            = "pop"
+	RuleShared         = "shared routines"
+	RuleUnused         = "unused functions"
+)
+
+// binaryOps computes x op y into M, given x in M and y in D.
+var binaryOps = map[string]string{
+	"add": "M=D+M",
+	"sub": "M=M-D",
+	"and": "M=D&M",
+	"or":  "M=D|M",
+}
+
+// incrementOps computes x op 1 into M, given x in M.
+var incrementOps = map[string]string{
+	"add": "M=M+1",
+	"sub": "M=M-1",
+}
+
+// compareJumps jumps if x - y in D compares as true, and negatedJumps if it
+// compares as false.
+var compareJumps = map[string]string{"eq": "JEQ", "gt": "JGT", "lt": "JLT"}
+var negatedJumps = map[string]string{"eq": "JNE", "gt": "JLE", "lt": "JGE"}
+
+// segmentBases are the pointers to the segments whose address is only known
+// at run time.
+var segmentBases = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+// Saved returns the ROM words saved by each optimization rule so far.
+func (cw *CodeWriter) Saved() map[string]int {
+	return cw.saved
+}
+
+// writeFused writes the first commands as one piece of code if they match
+// one of the rules below and returns how many commands it wrote, or 0.
+//
+// The rules keep the value a command would push in D, so the command that
+// consumes it does not go through the stack:
+//
+//   - push, then add, sub, and, or, eq, gt or lt with the pushed value as y
+//   - push, then pop
+//   - push, then if-goto
+//   - push, compare, an optional not and if-goto
+//   - compare, an optional not and if-goto, jumping on x - y directly
+//   - not and if-goto
+//
+// A push or pop on its own is written with a shorter address computation
+// where the segment and index allow it. Labels end every sequence, as code
+// can jump to them. The code of each rule leaves the segments and the stack
+// below SP as the commands written one by one do; only the scratch registers
+// and the words above SP may differ.
+func (cw *CodeWriter) writeFused(cmds []Command) (int, error) {
+	code, rule, n := cw.fuse(cmds)
+	if n == 0 {
+		return 0, nil
+	}
+
+	// measure the code the commands would have had one by one, which also
+	// checks their arguments
+	inline := NewCodeWriter(ioutil.Discard)
+	inline.SharedRoutines = cw.SharedRoutines
+	inline.name = cw.name
+	inline.currentFunctionName = cw.currentFunctionName
+	if err := inline.GenerateCode(cmds[:n]); err != nil {
+		return 0, err
+	}
+
+	before := cw.words
+	err := cw.writeSource(cmds[:n], func() error {
+		cw.fPrintln(strings.Join(code, "\n"))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	cw.saved[rule] += inline.words - (cw.words - before)
+	return n, nil
+}
+
+func (cw *CodeWriter) fuse(cmds []Command) (code []string, rule string, n int) {
+	is := func(i int, name string) bool {
+		return i < len(cmds) && cmds[i].Name == name
+	}
+
+	// compareJump returns the jump of compare at i, an optional not and an
+	// if-goto, and the index of the if-goto
+	compareJump := func(i int) (string, int, bool) {
+		if i >= len(cmds) {
+			return "", 0, false
+		}
+		jump, ok := compareJumps[cmds[i].Name]
+		if !ok {
+			return "", 0, false
+		}
+		if is(i+1, "not") {
+			jump, i = negatedJumps[cmds[i].Name], i+1
+		}
+		return jump, i + 1, is(i+1, "if-goto")
+	}
+
+	c := cmds[0]
+	switch c.CommandType {
+	case CArithmetic:
+		if jump, j, ok := compareJump(0); ok {
+			code = []string{cw.pop(), "@SP", "AM=M-1", "D=M-D", "@" + cw.generateLabel(cmds[j].Arg1), "D;" + jump}
+			return code, RuleCompareJump, j + 1
+		}
+		if c.Name == "not" && is(1, "if-goto") {
+			code = []string{"@SP", "AM=M-1", "D=!M", "@" + cw.generateLabel(cmds[1].Arg1), "D;JNE"}
+			return code, RuleNotJump, 2
+		}
+
+	case CPush:
+		load, ok := cw.loadD(c.Arg1, c.Arg2)
+		if !ok {
+			return nil, "", 0
+		}
+		if jump, j, ok := compareJump(1); ok {
+			code = append(load, "@SP", "AM=M-1", "D=M-D", "@"+cw.generateLabel(cmds[j].Arg1), "D;"+jump)
+			return code, RulePushCompare, j + 1
+		}
+		if len(cmds) < 2 {
+			return cw.fusePush(c.Arg1, load)
+		}
+
+		next := cmds[1]
+		switch next.CommandType {
+		case CArithmetic:
+			if op, ok := binaryOps[next.Name]; ok {
+				if inc, ok := incrementOps[next.Name]; ok && c.Arg1 == "constant" && c.Arg2 == 1 {
+					code = []string{"@SP", "A=M-1", inc}
+				} else {
+					code = append(load, "@SP", "A=M-1", op)
+				}
+				return code, RulePushArithmetic, 2
+			}
+			if jump, ok := compareJumps[next.Name]; ok {
+				end := "END" + strconv.Itoa(cw.labelCnt)
+				cw.labelCnt++
+				code = append(load,
+					"@SP", "A=M-1", "D=M-D", // x - y
+					"M=-1", // true unless the jump below is not taken
+					"@"+end, "D;"+jump,
+					"@SP", "A=M-1", "M=0",
+					"("+end+")")
+				return code, RulePushArithmetic, 2
+			}
+		case CPop:
+			prepare, store, ok := cw.storeD(next.Arg1, next.Arg2)
+			if !ok {
+				break
+			}
+			code = append(append(prepare, load...), store...)
+			return code, RulePushPop, 2
+		case CIfGoto:
+			code = append(load, "@"+cw.generateLabel(next.Arg1), "D;JNE")
+			return code, RulePushJump, 2
+		}
+		return cw.fusePush(c.Arg1, load)
+
+	case CPop:
+		// writePop already stores statics directly
+		prepare, store, ok := cw.storeD(c.Arg1, c.Arg2)
+		if ok && prepare == nil && c.Arg1 != "static" {
+			return append([]string{cw.pop()}, store...), RulePop, 1
+		}
+	}
+	return nil, "", 0
+}
+
+// fusePush writes a push on its own when load is shorter than the code
+// writePush loads its value with.
+func (cw *CodeWriter) fusePush(segment string, load []string) ([]string, string, int) {
+	// constants and statics already load in two instructions
+	if len(load) == 5 || segment == "constant" || segment == "static" {
+		return nil, "", 0
+	}
+	return append(load, cw.push()), RulePush, 1
+}
+
+// directAddress returns the address of segment[index], as a symbol or a
+// number, for the segments whose address is known when translating.
+func (cw *CodeWriter) directAddress(segment string, index int) (string, bool) {
+	switch segment {
+	case "pointer":
+		return strconv.Itoa(3 + index), true
+	case "temp":
+		return strconv.Itoa(5 + index), true
+	case "static":
+		return cw.name + "." + strconv.Itoa(index), true
+	}
+	return "", false
+}
+
+// loadD returns code that loads segment[index] into D.
+func (cw *CodeWriter) loadD(segment string, index int) ([]string, bool) {
+	if segment == "constant" {
+		return []string{"@" + strconv.Itoa(index), "D=A"}, true
+	}
+	if address, ok := cw.directAddress(segment, index); ok {
+		return []string{"@" + address, "D=M"}, true
+	}
+
+	base, ok := segmentBases[segment]
+	if !ok {
+		return nil, false
+	}
+	switch index {
+	case 0:
+		return []string{"@" + base, "A=M", "D=M"}, true
+	case 1:
+		return []string{"@" + base, "A=M+1", "D=M"}, true
+	}
+	return []string{"@" + strconv.Itoa(index), "D=A", "@" + base, "A=D+M", "D=M"}, true
+}
+
+// storeD returns code that stores D into segment[index]. When the address
+// has to be computed with D, prepare computes it into R13 and has to run
+// before D is loaded.
+func (cw *CodeWriter) storeD(segment string, index int) (prepare []string, store []string, ok bool) {
+	if address, ok := cw.directAddress(segment, index); ok {
+		return nil, []string{"@" + address, "M=D"}, true
+	}
+
+	base, ok := segmentBases[segment]
+	if !ok {
+		return nil, nil, false
+	}
+	switch index {
+	case 0:
+		return nil, []string{"@" + base, "A=M", "M=D"}, true
+	case 1:
+		return nil, []string{"@" + base, "A=M+1", "M=D"}, true
+	}
+	prepare = []string{"@" + base, "D=M", "@" + strconv.Itoa(index), "D=D+A", "@R13", "M=D"}
+	return prepare, []string{"@R13", "A=M", "M=D"}, true
+}
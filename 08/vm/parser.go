@@ -0,0 +1,145 @@
+// Package vm reads programs written in the Hack VM language and translates
+// them into Hack assembly.
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type CommandType int
+
+const (
+	CArithmetic CommandType = iota
+	CPush
+	CPop
+	CLabel
+	CGoto
+	CIfGoto
+	CFunction
+	CReturn
+	CCall
+)
+
+// Command is a VM command. Name is the command itself, e.g. "push" or
+// "add"; Arg1 and Arg2 are its arguments, if any. Line is the line of the
+// command in its file, starting at 1.
+type Command struct {
+	CommandType CommandType
+	Name        string
+	Arg1        string
+	Arg2        int
+	Line        int
+}
+
+var commandTable = map[string]CommandType{
+	"add":  CArithmetic,
+	"sub":  CArithmetic,
+	"neg":  CArithmetic,
+	"eq":   CArithmetic,
+	"gt":   CArithmetic,
+	"lt":   CArithmetic,
+	"and":  CArithmetic,
+	"or":   CArithmetic,
+	"not":  CArithmetic,
+	"push": CPush,
+	"pop":  CPop,
+	"label": CLabel,
+	"goto": CGoto,
+	"if-goto": CIfGoto,
+	"function": CFunction,
+	"return": CReturn,
+	"call": CCall,
+}
+
+// argCounts are the numbers of arguments of the command types.
+var argCounts = map[CommandType]int{
+	CArithmetic: 0,
+	CPush:       2,
+	CPop:        2,
+	CLabel:      1,
+	CGoto:       1,
+	CIfGoto:     1,
+	CFunction:   2,
+	CReturn:     0,
+	CCall:       2,
+}
+
+type Parser struct {
+	reader io.Reader
+
+	// File is the name of the file in the positions of errors.
+	File string
+}
+
+func NewParser(reader io.Reader) *Parser {
+	return &Parser{reader: reader}
+}
+
+// Parse reads all commands. Every malformed command is returned together as
+// an ErrorList.
+func (p *Parser)Parse() ([]Command, error) {
+	var commands []Command
+	var errs ErrorList
+
+	s := bufio.NewScanner(p.reader)
+	line := 0
+	for s.Scan() {
+		line++
+		txt := s.Text()
+		txt = strings.Split(txt, "//")[0]
+		txt = strings.TrimSpace(txt)
+
+		if txt == "" {
+			continue
+		}
+
+		pos := Pos{File: p.File, Line: line}
+		fields := strings.Fields(txt)
+		c := fields[0]
+		cType, ok := commandTable[c]
+		if !ok {
+			errs.Add(pos, "invalid command: %s", txt)
+			continue
+		}
+		if n := len(fields) - 1; n != argCounts[cType] {
+			errs.Add(pos, "%s takes %d arguments, but has %d: %s", c, argCounts[cType], n, txt)
+			continue
+		}
+
+		cmd := Command{CommandType: cType, Name: c, Line: line}
+		if len(fields) > 1 {
+			cmd.Arg1 = fields[1]
+		}
+		if len(fields) > 2 {
+			arg2, err := strconv.Atoi(fields[2])
+			if err != nil || arg2 < 0 || arg2 > 32767 {
+				errs.Add(pos, "%s is not a number in range 0..32767: %s", fields[2], txt)
+				continue
+			}
+			cmd.Arg2 = arg2
+		}
+		commands = append(commands, cmd)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// String formats c as a line of VM code.
+func (c Command) String() string {
+	switch c.CommandType {
+	case CArithmetic, CReturn:
+		return c.Name
+	case CLabel, CGoto, CIfGoto:
+		return c.Name + " " + c.Arg1
+	}
+	return fmt.Sprintf("%s %s %d", c.Name, c.Arg1, c.Arg2)
+}
@@ -0,0 +1,65 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SourceMap relates the lines of a translated program to the VM commands
+// they were translated from.
+type SourceMap struct {
+	Entries []SourceMapEntry `json:"entries"`
+}
+
+// SourceMapEntry relates the lines From to To of the assembly program,
+// starting at 1, to the command at Line of File. Commands fused into one
+// piece of code have one entry each, with the same lines. The bootstrap
+// code and the shared routines have no entries.
+type SourceMapEntry struct {
+	From     int    `json:"from"`
+	To       int    `json:"to"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function,omitempty"`
+	Command  string `json:"command"`
+}
+
+// WriteJSON writes m as indented JSON.
+func (m *SourceMap) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+// writeSource writes the code of cmds with write. With a source map, the
+// code is preceded by a comment like "// Main.vm:12: push local 2" for each
+// command, and its lines are added to the map.
+func (cw *CodeWriter) writeSource(cmds []Command, write func() error) error {
+	if cw.SourceMap == nil {
+		return write()
+	}
+
+	for _, c := range cmds {
+		cw.fPrintln(fmt.Sprintf("// %s.vm:%d: %s", cw.name, c.Line, c))
+	}
+	from := cw.lines + 1
+	if err := write(); err != nil {
+		return err
+	}
+	for _, c := range cmds {
+		cw.SourceMap.Entries = append(cw.SourceMap.Entries, SourceMapEntry{
+			From:     from,
+			To:       cw.lines,
+			File:     cw.name + ".vm",
+			Line:     c.Line,
+			Function: cw.currentFunctionName,
+			Command:  c.String(),
+		})
+	}
+	return nil
+}
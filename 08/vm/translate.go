@@ -0,0 +1,186 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// File is one .vm file of a program: its name without the .vm extension,
+// which is also the name of its class, and its source.
+type File struct {
+	Name string
+	Src  io.Reader
+}
+
+// Options control the translation of a program.
+type Options struct {
+	// Bootstrap starts the program with code that sets SP to 256 and calls
+	// Sys.init. Translate fails with ErrNoSysInit if no file defines it.
+	Bootstrap bool
+
+	// SharedRoutines writes calls, returns and comparisons as jumps to
+	// routines that are written once, at the end of the program.
+	SharedRoutines bool
+
+	// Optimize fuses common sequences of commands into shorter code.
+	Optimize bool
+
+	// RemoveUnused drops the functions that Sys.init does not call, directly
+	// or through other functions, before writing the code.
+	RemoveUnused bool
+
+	// SourceMap, if not nil, receives the lines of the code of each command,
+	// and the code is preceded by a comment with the file, line and text of
+	// the command.
+	SourceMap *SourceMap
+}
+
+// SizeReport compares the ROM size of a translated program to its size
+// without the options that make it smaller. Saved breaks the difference
+// down by optimization rule, including RuleShared for the shared routines
+// and RuleUnused for the removed functions.
+type SizeReport struct {
+	Before int
+	After  int
+	Saved  map[string]int
+}
+
+func (r SizeReport) String() string {
+	var rules []string
+	for rule := range r.Saved {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	var details []string
+	for _, rule := range rules {
+		details = append(details, fmt.Sprintf("%s: %d", rule, r.Saved[rule]))
+	}
+
+	s := fmt.Sprintf("%d -> %d words, saved %d", r.Before, r.After, r.Before-r.After)
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// program is a parsed file.
+type program struct {
+	name string
+	cmds []Command
+}
+
+// Translate translates the files of a program, in order, into one assembly
+// program written to w. The output only depends on the files and options,
+// so translating the same program twice gives the same code. The files are
+// checked before any code is written, and every error found is returned
+// together as an ErrorList.
+func Translate(w io.Writer, files []File, opts Options) (SizeReport, error) {
+	var programs []program
+	var errs ErrorList
+	for _, f := range files {
+		p := NewParser(f.Src)
+		p.File = f.Name + ".vm"
+		cmds, err := p.Parse()
+		if list, ok := err.(ErrorList); ok {
+			errs = append(errs, list...)
+			continue
+		}
+		if err != nil {
+			return SizeReport{}, fmt.Errorf("%s.vm: %s", f.Name, err)
+		}
+		programs = append(programs, program{name: f.Name, cmds: cmds})
+	}
+	if err := errs.Err(); err != nil {
+		return SizeReport{}, err
+	}
+	// a program without its entry point calls functions of the OS that are
+	// missing as well, so this is the error to report
+	if opts.Bootstrap && !defines(programs, entryFunction) {
+		return SizeReport{}, ErrNoSysInit
+	}
+	if err := validate(programs); err != nil {
+		return SizeReport{}, err
+	}
+
+	all := programs
+	if opts.RemoveUnused {
+		var err error
+		if programs, err = removeUnused(programs); err != nil {
+			return SizeReport{}, err
+		}
+	}
+
+	cw, err := generate(w, programs, opts)
+	if err != nil {
+		return SizeReport{}, err
+	}
+
+	report := SizeReport{Before: cw.Words(), After: cw.Words(), Saved: map[string]int{}}
+	if opts.SharedRoutines || opts.Optimize || opts.RemoveUnused {
+		plain, err := generate(ioutil.Discard, all, Options{Bootstrap: opts.Bootstrap})
+		if err != nil {
+			return SizeReport{}, err
+		}
+		report.Before = plain.Words()
+
+		rest := report.Before - report.After
+		if opts.RemoveUnused {
+			// the plain code of the removed functions, so that the other
+			// rules only count what they saved in the functions kept
+			used, err := generate(ioutil.Discard, programs, Options{Bootstrap: opts.Bootstrap})
+			if err != nil {
+				return SizeReport{}, err
+			}
+			if unused := report.Before - used.Words(); unused != 0 {
+				report.Saved[RuleUnused] = unused
+				rest -= unused
+			}
+		}
+		for rule, saved := range cw.Saved() {
+			report.Saved[rule] = saved
+			rest -= saved
+		}
+		if opts.SharedRoutines && rest != 0 {
+			report.Saved[RuleShared] = rest
+		}
+	}
+	return report, nil
+}
+
+// defines reports whether one of the programs defines function f.
+func defines(programs []program, f string) bool {
+	for _, p := range programs {
+		for _, c := range p.cmds {
+			if c.CommandType == CFunction && c.Arg1 == f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generate writes the code of the parsed files.
+func generate(w io.Writer, programs []program, opts Options) (*CodeWriter, error) {
+	cw := NewCodeWriter(w)
+	cw.SharedRoutines = opts.SharedRoutines
+	cw.Optimize = opts.Optimize
+	cw.SourceMap = opts.SourceMap
+	if opts.Bootstrap {
+		if err := cw.BootstrapCode(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range programs {
+		cw.SetFileName(p.name)
+		if err := cw.GenerateCode(p.cmds); err != nil {
+			return nil, fmt.Errorf("%s.vm: %s", p.name, err)
+		}
+	}
+	cw.WriteSharedRoutines()
+	return cw, nil
+}
@@ -0,0 +1,222 @@
+package vm_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/tst"
+	"github.com/ebakazu/nand2tetris/08/vm"
+)
+
+var modes = []struct {
+	name string
+	opts vm.Options
+}{
+	{"plain", vm.Options{}},
+	{"shared", vm.Options{SharedRoutines: true}},
+	{"optimize", vm.Options{Optimize: true}},
+}
+
+// TestTestcases translates the programs of the tests of chapters 07 and 08
+// with each set of options and runs their test scripts on the Hack computer.
+// The programs of directories with a Sys.vm start at Sys.init, the others
+// are translated without a bootstrap, as 08/main.go does.
+func TestTestcases(t *testing.T) {
+	scripts, err := filepath.Glob("../../0[78]/testcases/*/*/*.tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no test scripts found")
+	}
+
+	for _, script := range scripts {
+		script := script
+		name := strings.TrimSuffix(filepath.Base(script), ".tst")
+		for _, mode := range modes {
+			mode := mode
+			t.Run(name+"/"+mode.name, func(t *testing.T) {
+				dir := t.TempDir()
+				if err := translate(filepath.Dir(script), filepath.Join(dir, name+".asm"), mode.opts); err != nil {
+					t.Fatal(err)
+				}
+				for _, ext := range []string{".tst", ".cmp"} {
+					if err := copyFile(strings.TrimSuffix(script, ".tst")+ext, filepath.Join(dir, name+ext)); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				err := tst.RunFile(filepath.Join(dir, name+".tst"))
+				var cmpErr *tst.CompareError
+				if errors.As(err, &cmpErr) {
+					t.Fatalf("output differs from %s.cmp: %s", name, err)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+// translate translates the .vm files of dir into the assembly file out.
+func translate(dir string, out string, opts vm.Options) error {
+	locs, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return err
+	}
+
+	var files []vm.File
+	for _, loc := range locs {
+		src, err := os.ReadFile(loc)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(loc), ".vm")
+		files = append(files, vm.File{Name: name, Src: bytes.NewReader(src)})
+		if name == "Sys" {
+			opts.Bootstrap = true
+		}
+	}
+
+	asm := bytes.NewBuffer([]byte{})
+	if _, err := vm.Translate(asm, files, opts); err != nil {
+		return err
+	}
+	return os.WriteFile(out, asm.Bytes(), 0644)
+}
+
+func copyFile(from string, to string) error {
+	b, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to, b, 0644)
+}
+
+func TestTranslateWithoutSysInit(t *testing.T) {
+	src := "function Main.main 0\npush constant 0\nreturn\n"
+	for _, opts := range []vm.Options{{Bootstrap: true}, {Bootstrap: true, RemoveUnused: true}} {
+		files := []vm.File{{Name: "Main", Src: strings.NewReader(src)}}
+		if _, err := vm.Translate(&bytes.Buffer{}, files, opts); !errors.Is(err, vm.ErrNoSysInit) {
+			t.Errorf("%+v: got %v, want %v", opts, err, vm.ErrNoSysInit)
+		}
+	}
+
+	// without a bootstrap, the program starts at its first command
+	files := []vm.File{{Name: "Main", Src: strings.NewReader(src)}}
+	if _, err := vm.Translate(&bytes.Buffer{}, files, vm.Options{}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTranslateDeterministic translates the same program twice in a row
+// and twice at once, with every option, and expects the same code each
+// time.
+func TestTranslateDeterministic(t *testing.T) {
+	dir := "../testcases/FunctionCalls/StaticsTest"
+	locs, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs := map[string][]byte{}
+	for _, loc := range locs {
+		src, err := os.ReadFile(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[strings.TrimSuffix(filepath.Base(loc), ".vm")] = src
+	}
+
+	translate := func() (string, error) {
+		var files []vm.File
+		for _, loc := range locs {
+			name := strings.TrimSuffix(filepath.Base(loc), ".vm")
+			files = append(files, vm.File{Name: name, Src: bytes.NewReader(srcs[name])})
+		}
+		opts := vm.Options{Bootstrap: true, SharedRoutines: true, Optimize: true, RemoveUnused: true, SourceMap: &vm.SourceMap{}}
+		var asm bytes.Buffer
+		if _, err := vm.Translate(&asm, files, opts); err != nil {
+			return "", err
+		}
+		return asm.String(), nil
+	}
+
+	want, err := translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := translate(); err != nil || got != want {
+		t.Fatalf("the second translation differs (%v)", err)
+	}
+
+	var wg sync.WaitGroup
+	got := make([]string, 2)
+	errs := make([]error, 2)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], errs[i] = translate()
+		}(i)
+	}
+	wg.Wait()
+	for i := range got {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got[i] != want {
+			t.Error("a concurrent translation differs")
+		}
+	}
+}
+
+// TestOptimizeReport translates the program that exercises each rule of
+// the optimizing mode and expects every rule to save words.
+func TestOptimizeReport(t *testing.T) {
+	src, err := os.ReadFile("../testcases/Optimize/FusedCommands/FusedCommands.vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []string{vm.RuleCompareJump, vm.RuleNotJump, vm.RulePushArithmetic, vm.RulePushCompare, vm.RulePushPop, vm.RulePushJump, vm.RulePush, vm.RulePop}
+
+	for _, mode := range []struct {
+		name string
+		opts vm.Options
+	}{
+		{"plain", vm.Options{Optimize: true}},
+		{"shared", vm.Options{Optimize: true, SharedRoutines: true}},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			files := []vm.File{{Name: "FusedCommands", Src: bytes.NewReader(src)}}
+			report, err := vm.Translate(ioutil.Discard, files, mode.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.After >= report.Before {
+				t.Errorf("%s: nothing saved", report)
+			}
+			for _, rule := range rules {
+				if report.Saved[rule] <= 0 {
+					t.Errorf("%s: rule %q saved %d words", report, rule, report.Saved[rule])
+				}
+			}
+			total := 0
+			for rule, saved := range report.Saved {
+				if saved <= 0 {
+					t.Errorf("%s: rule %q saved %d words", report, rule, saved)
+				}
+				total += saved
+			}
+			if total != report.Before-report.After {
+				t.Errorf("%s: the rules saved %d words in all", report, total)
+			}
+		})
+	}
+}
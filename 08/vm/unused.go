@@ -0,0 +1,64 @@
+package vm
+
+import "fmt"
+
+// entryFunction is the function a bootstrapped program starts at.
+const entryFunction = "Sys.init"
+
+// removeUnused drops the functions that cannot be reached through calls from
+// Sys.init and returns the remaining programs. Commands before the first
+// function of a file are not part of any function: they run when the program
+// starts with them, so they are kept, and the functions they call are
+// reachable too.
+func removeUnused(programs []program) ([]program, error) {
+	calls := map[string][]string{}
+	defined := map[string]bool{}
+	var roots []string
+	for _, p := range programs {
+		function := ""
+		for _, c := range p.cmds {
+			switch c.CommandType {
+			case CFunction:
+				function = c.Arg1
+				defined[function] = true
+			case CCall:
+				if function == "" {
+					roots = append(roots, c.Arg1)
+				} else {
+					calls[function] = append(calls[function], c.Arg1)
+				}
+			}
+		}
+	}
+	if !defined[entryFunction] {
+		return nil, fmt.Errorf("no %s to find the used functions from", entryFunction)
+	}
+
+	// walk the call graph from the entry function
+	reachable := map[string]bool{}
+	stack := append(roots, entryFunction)
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[f] {
+			continue
+		}
+		reachable[f] = true
+		stack = append(stack, calls[f]...)
+	}
+
+	kept := make([]program, len(programs))
+	for i, p := range programs {
+		kept[i].name = p.name
+		keep := true
+		for _, c := range p.cmds {
+			if c.CommandType == CFunction {
+				keep = reachable[c.Arg1]
+			}
+			if keep {
+				kept[i].cmds = append(kept[i].cmds, c)
+			}
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRemoveUnused(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // the commands kept, as file: command
+	}{
+		{
+			"reachable from Sys.init",
+			map[string]string{
+				"Sys":  "function Sys.init 0\ncall Main.main 0\nreturn",
+				"Main": "function Main.main 0\ncall Main.helper 0\nreturn\nfunction Main.helper 0\nreturn\nfunction Main.unused 0\ncall Main.helper2 0\nreturn\nfunction Main.helper2 0\nreturn",
+			},
+			[]string{
+				"Main: function Main.main 0", "Main: call Main.helper 0", "Main: return",
+				"Main: function Main.helper 0", "Main: return",
+				"Sys: function Sys.init 0", "Sys: call Main.main 0", "Sys: return",
+			},
+		},
+		{
+			"recursion",
+			map[string]string{
+				"Sys": "function Sys.init 0\ncall Sys.init 0\nreturn\nfunction Sys.even 0\ncall Sys.odd 0\nreturn\nfunction Sys.odd 0\ncall Sys.even 0\nreturn",
+			},
+			[]string{"Sys: function Sys.init 0", "Sys: call Sys.init 0", "Sys: return"},
+		},
+		{
+			"top-level commands",
+			map[string]string{
+				"Main": "push constant 1\ncall Lib.f 1\nlabel END\ngoto END\nfunction Main.unused 0\nreturn",
+				"Lib":  "function Lib.f 0\nreturn\nfunction Lib.g 0\nreturn",
+				"Sys":  "function Sys.init 0\nreturn",
+			},
+			[]string{
+				"Lib: function Lib.f 0", "Lib: return",
+				"Main: push constant 1", "Main: call Lib.f 1", "Main: label END", "Main: goto END",
+				"Sys: function Sys.init 0", "Sys: return",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept, err := removeUnused(parsePrograms(t, test.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range kept {
+				for _, c := range p.cmds {
+					got = append(got, p.name+": "+c.String())
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRemoveUnusedWithoutSysInit(t *testing.T) {
+	programs := parsePrograms(t, map[string]string{"Main": "function Main.main 0\nreturn"})
+	_, err := removeUnused(programs)
+	if want := "no Sys.init to find the used functions from"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+// parsePrograms parses the files, given by name, in the order of their
+// names.
+func parsePrograms(t *testing.T, files map[string]string) []program {
+	t.Helper()
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var programs []program
+	for _, name := range names {
+		p := NewParser(strings.NewReader(files[name]))
+		p.File = name + ".vm"
+		cmds, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs = append(programs, program{name: name, cmds: cmds})
+	}
+	return programs
+}
@@ -0,0 +1,100 @@
+package vm
+
+import "fmt"
+
+// validate checks what the parser cannot see in a command on its own: the
+// segments and their indices, the names of labels, and the functions the
+// commands define and call and the static variables they use across the
+// whole program. Labels are only allowed outside functions in programs
+// without functions, like the tests of the course that are translated
+// without a bootstrap.
+func validate(programs []program) error {
+	var errs ErrorList
+
+	defined := map[string]Pos{}
+	for _, p := range programs {
+		for _, c := range p.cmds {
+			if c.CommandType != CFunction {
+				continue
+			}
+			if _, ok := defined[c.Arg1]; !ok {
+				defined[c.Arg1] = Pos{File: p.name + ".vm", Line: c.Line}
+			}
+		}
+	}
+
+	// the static variables of all files share RAM[16..255]
+	statics := map[string]bool{}
+
+	for _, p := range programs {
+		function := ""
+		for _, c := range p.cmds {
+			pos := Pos{File: p.name + ".vm", Line: c.Line}
+			switch c.CommandType {
+			case CArithmetic:
+				if t, ok := commandTable[c.Name]; !ok || t != CArithmetic {
+					errs.Add(pos, "unknown arithmetic command: %s", c.Name)
+				}
+			case CPush, CPop:
+				if msg := checkSegment(c); msg != "" {
+					errs.Add(pos, "%s: %s", msg, c)
+					break
+				}
+				key := fmt.Sprintf("%s.%d", p.name, c.Arg2)
+				if c.Arg1 == "static" && !statics[key] {
+					statics[key] = true
+					if len(statics) == maxStatics+1 {
+						errs.Add(pos, "the program needs more than %d static variables: %s", maxStatics, c)
+					}
+				}
+			case CLabel, CGoto, CIfGoto:
+				if !labelRegexp.MatchString(c.Arg1) {
+					errs.Add(pos, "invalid label name: %s", c.Arg1)
+				}
+				if function == "" && len(defined) > 0 {
+					errs.Add(pos, "%s is outside a function", c)
+				}
+			case CFunction:
+				function = c.Arg1
+				if first := defined[c.Arg1]; first != pos {
+					errs.Add(pos, "function %s is already defined at %s", c.Arg1, first)
+				}
+			case CCall:
+				if _, ok := defined[c.Arg1]; !ok {
+					errs.Add(pos, "undefined function %s", c.Arg1)
+				}
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// maxStatics is the number of static variables that fit in RAM[16..255].
+const maxStatics = 240
+
+// checkSegment returns why the segment and index of push or pop c are
+// invalid, or "" if they are valid.
+func checkSegment(c Command) string {
+	switch c.Arg1 {
+	case "constant":
+		if c.CommandType == CPop {
+			return "cannot pop to the constant segment"
+		}
+	case "local", "argument", "this", "that":
+	case "static":
+		if c.Arg2 >= maxStatics {
+			return fmt.Sprintf("static index %d is not in range 0..%d", c.Arg2, maxStatics-1)
+		}
+	case "pointer":
+		if c.Arg2 > 1 {
+			return fmt.Sprintf("pointer index %d is not 0 or 1", c.Arg2)
+		}
+	case "temp":
+		if c.Arg2 > 7 {
+			return fmt.Sprintf("temp index %d is not in range 0..7", c.Arg2)
+		}
+	default:
+		return "undefined segment: " + c.Arg1
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			"segments",
+			map[string]string{"Main": "pop constant 1\npush pointer 2\npush temp 8\npop static 240\npush heap 0\npush temp 7"},
+			[]string{
+				"Main.vm:1: cannot pop to the constant segment: pop constant 1",
+				"Main.vm:2: pointer index 2 is not 0 or 1: push pointer 2",
+				"Main.vm:3: temp index 8 is not in range 0..7: push temp 8",
+				"Main.vm:4: static index 240 is not in range 0..239: pop static 240",
+				"Main.vm:5: undefined segment: heap: push heap 0",
+			},
+		},
+		{
+			"statics of all files",
+			map[string]string{"A": statics(200), "B": statics(40) + "push static 40\npush static 41\npush static 0"},
+			[]string{"B.vm:41: the program needs more than 240 static variables: push static 40"},
+		},
+		{
+			"labels",
+			map[string]string{"Main": "label 1ST\ngoto a-b\nlabel x\nif-goto x\nlabel _.:9"},
+			[]string{
+				"Main.vm:1: invalid label name: 1ST",
+				"Main.vm:2: invalid label name: a-b",
+			},
+		},
+		{
+			"labels outside functions",
+			map[string]string{"Main": "label START\ngoto START\nfunction Main.main 0\nlabel L\nreturn"},
+			[]string{
+				"Main.vm:1: label START is outside a function",
+				"Main.vm:2: goto START is outside a function",
+			},
+		},
+		{
+			"functions",
+			map[string]string{
+				"A": "function A.f 0\nreturn\nfunction A.f 0\nreturn",
+				"B": "function A.f 1\ncall A.g 0\ncall A.f 0\nreturn",
+			},
+			[]string{
+				"A.vm:3: function A.f is already defined at A.vm:1",
+				"B.vm:1: function A.f is already defined at A.vm:1",
+				"B.vm:2: undefined function A.g",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validate(parsePrograms(t, test.files))
+			var got []string
+			if list, ok := err.(ErrorList); ok {
+				for _, e := range list {
+					got = append(got, e.Error())
+				}
+			} else if err != nil {
+				t.Fatalf("got %v, want an ErrorList", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+// TestValidateArithmetic checks a command the parser cannot produce.
+func TestValidateArithmetic(t *testing.T) {
+	programs := []program{{name: "Main", cmds: []Command{{CommandType: CArithmetic, Name: "mul", Line: 3}}}}
+	err := validate(programs)
+	if want := "Main.vm:3: unknown arithmetic command: mul"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := "push constant 1\nfoo\npush local\npush constant x // comment\nadd 1\npush constant 32768\nlabel\n"
+	p := NewParser(strings.NewReader(src))
+	p.File = "Main.vm"
+	_, err := p.Parse()
+	want := []string{
+		"Main.vm:2: invalid command: foo",
+		"Main.vm:3: push takes 2 arguments, but has 1: push local",
+		"Main.vm:4: x is not a number in range 0..32767: push constant x",
+		"Main.vm:5: add takes 0 arguments, but has 1: add 1",
+		"Main.vm:6: 32768 is not a number in range 0..32767: push constant 32768",
+		"Main.vm:7: label takes 1 arguments, but has 0: label",
+	}
+
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// statics returns a file that uses static variables 0 to n-1.
+func statics(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "push static %d\n", i)
+	}
+	return b.String()
+}
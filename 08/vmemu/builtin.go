@@ -0,0 +1,87 @@
+package vmemu
+
+import (
+	"fmt"
+)
+
+// Builtin is a VM function implemented in Go. It receives the arguments of
+// the call in order and returns the value the function returns; void
+// functions return 0.
+type Builtin func(m *Machine, args []uint16) (uint16, error)
+
+type builtin struct {
+	nArgs int
+	fn    Builtin
+}
+
+// Define makes f, taking nArgs arguments, callable by the program. A
+// function of the same name loaded from a .vm file takes precedence, so
+// builtins can be replaced by VM code.
+func (m *Machine) Define(f string, nArgs int, fn Builtin) {
+	m.builtins[f] = builtin{nArgs: nArgs, fn: fn}
+}
+
+// callBuiltin runs a builtin with the top n stack values as its arguments
+// and pushes its result.
+func (m *Machine) callBuiltin(f string, n int) error {
+	b, ok := m.builtins[f]
+	if !ok {
+		return fmt.Errorf("undefined function %s", f)
+	}
+	if n != b.nArgs {
+		return fmt.Errorf("%s takes %d arguments, but is called with %d", f, b.nArgs, n)
+	}
+
+	args := make([]uint16, n)
+	for i := n - 1; i >= 0; i-- {
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = v
+	}
+
+	v, err := b.fn(m, args)
+	if err != nil {
+		return err
+	}
+	return m.push(v)
+}
+
+// Call calls function f with args and returns its result. A function of the
+// program runs until it returns or the program halts, so builtins can use
+// the functions that replace other builtins.
+func (m *Machine) Call(f string, args ...uint16) (uint16, error) {
+	if !m.HasFunction(f) {
+		b, ok := m.builtins[f]
+		if !ok {
+			return 0, fmt.Errorf("undefined function %s", f)
+		}
+		if len(args) != b.nArgs {
+			return 0, fmt.Errorf("%s takes %d arguments, but is called with %d", f, b.nArgs, len(args))
+		}
+		return b.fn(m, args)
+	}
+
+	for _, v := range args {
+		if err := m.push(v); err != nil {
+			return 0, err
+		}
+	}
+
+	pc := m.PC
+	depth := len(m.frames)
+	if err := m.call(f, len(args), returnToHost); err != nil {
+		return 0, err
+	}
+	for len(m.frames) > depth {
+		if m.halted {
+			return 0, nil
+		}
+		if err := m.Step(); err != nil {
+			return 0, err
+		}
+	}
+	m.PC = pc
+	return m.pop()
+}
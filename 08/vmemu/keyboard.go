@@ -0,0 +1,104 @@
+package vmemu
+
+import (
+	"fmt"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+)
+
+func (m *Machine) installKeyboard() {
+	m.Define("Keyboard.init", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return 0, nil
+	})
+	m.Define("Keyboard.keyPressed", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return m.RAM[emulator.Keyboard], nil
+	})
+	m.Define("Keyboard.readChar", 0, func(m *Machine, args []uint16) (uint16, error) {
+		m.drawChar(0) // cursor
+		if err := m.waitKey(true); err != nil {
+			return 0, err
+		}
+		c := m.RAM[emulator.Keyboard]
+		if err := m.waitKey(false); err != nil {
+			return 0, err
+		}
+		m.drawChar(' ')
+		if _, err := m.Call("Output.printChar", c); err != nil {
+			return 0, err
+		}
+		return c, nil
+	})
+	m.Define("Keyboard.readLine", 1, func(m *Machine, args []uint16) (uint16, error) {
+		return m.readLine(args[0])
+	})
+	m.Define("Keyboard.readInt", 1, func(m *Machine, args []uint16) (uint16, error) {
+		s, err := m.readLine(args[0])
+		if err != nil || m.halted {
+			return 0, err
+		}
+		v, err := m.Call("String.intValue", s)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := m.Call("String.dispose", s); err != nil {
+			return 0, err
+		}
+		return v, nil
+	})
+}
+
+// readLine prints message and returns the line typed up to a newline as a
+// new string.
+func (m *Machine) readLine(message uint16) (uint16, error) {
+	if _, err := m.Call("Output.printString", message); err != nil {
+		return 0, err
+	}
+	s, err := m.Call("String.new", readLineLength)
+	if err != nil {
+		return 0, err
+	}
+
+	for length := 0; !m.halted; {
+		c, err := m.Call("Keyboard.readChar")
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == newLine:
+			return s, nil
+		case c == backSpace:
+			if length > 0 {
+				_, err = m.Call("String.eraseLastChar", s)
+				length--
+			}
+		case length < readLineLength:
+			_, err = m.Call("String.appendChar", s, c)
+			length++
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// waitKey advances Steps along the Keys script until a key is pressed, or
+// until none is if pressed is false.
+func (m *Machine) waitKey(pressed bool) error {
+	for {
+		if m.Keys != nil {
+			m.RAM[emulator.Keyboard] = m.Keys.Key(m.Steps)
+		}
+		if (m.RAM[emulator.Keyboard] != 0) == pressed {
+			return nil
+		}
+		if m.Keys == nil {
+			return fmt.Errorf("waiting for the keyboard, but there is no keystroke script")
+		}
+		next, ok := m.Keys.Next(m.Steps)
+		if !ok {
+			return fmt.Errorf("waiting for the keyboard after the last scripted keystroke")
+		}
+		m.Steps = next
+	}
+}
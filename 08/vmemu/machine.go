@@ -0,0 +1,504 @@
+// Package vmemu interprets Hack VM programs directly, without translating
+// them to assembly first.
+package vmemu
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/08/vm"
+)
+
+const (
+	RAMSize = 1 << 15
+
+	// RAM addresses of the virtual registers
+	SP   = 0
+	LCL  = 1
+	ARG  = 2
+	THIS = 3
+	THAT = 4
+
+	tempBase   = 5
+	tempSize   = 8
+	staticBase = 16
+	StackBase  = 256
+
+	// returnToHost is the return address of calls made by Call.
+	returnToHost = 1<<16 - 1
+)
+
+// instruction is a command together with what loading resolved about it.
+type instruction struct {
+	vm.Command
+	file     string
+	function string
+	target   int // command index of a goto or if-goto, or address of a static
+}
+
+func (ins instruction) String() string {
+	if ins.function == "" {
+		return fmt.Sprintf("%s: %s", ins.file, ins.Command)
+	}
+	return fmt.Sprintf("%s: %s: %s", ins.file, ins.function, ins.Command)
+}
+
+// Frame is an active function call.
+type Frame struct {
+	Function string
+	ReturnPC int
+}
+
+// Machine executes VM commands with the memory layout of the Hack platform:
+// the virtual registers at RAM[0..4], temp at RAM[5..12], statics from
+// RAM[16] and the stack from RAM[256]. Return addresses saved on the stack
+// are command indices.
+type Machine struct {
+	RAM [RAMSize]uint16
+	PC  int
+
+	Steps uint64
+
+	// Keys, if set, holds the keyboard register for every step.
+	Keys *emulator.KeyScript
+
+	program    []instruction
+	functions  map[string]int
+	builtins   map[string]builtin
+	statics    map[string]int
+	nextStatic int
+	frames     []Frame
+	halted     bool
+
+	jack *jackOS
+}
+
+func New() *Machine {
+	return &Machine{
+		functions:  map[string]int{},
+		builtins:   map[string]builtin{},
+		statics:    map[string]int{},
+		nextStatic: staticBase,
+	}
+}
+
+// Load appends the commands of one .vm file to the program. name is the
+// file name without extension; it scopes the static segment.
+func (m *Machine) Load(name string, commands []vm.Command) error {
+	start := len(m.program)
+	labels := map[string]int{}
+
+	function := ""
+	for _, c := range commands {
+		ins := instruction{Command: c, file: name}
+
+		switch c.CommandType {
+		case vm.CFunction:
+			if _, ok := m.functions[c.Arg1]; ok {
+				return fmt.Errorf("%s: function %s is already defined", name, c.Arg1)
+			}
+			function = c.Arg1
+			m.functions[function] = len(m.program)
+		case vm.CLabel:
+			label := function + "$" + c.Arg1
+			if _, ok := labels[label]; ok {
+				return fmt.Errorf("%s: label %s is already defined", name, label)
+			}
+			labels[label] = len(m.program)
+		case vm.CPush, vm.CPop:
+			if c.Arg1 == "static" {
+				ins.target = m.static(name, c.Arg2)
+			}
+		}
+
+		ins.function = function
+		m.program = append(m.program, ins)
+	}
+
+	for i := start; i < len(m.program); i++ {
+		ins := &m.program[i]
+		if ins.CommandType != vm.CGoto && ins.CommandType != vm.CIfGoto {
+			continue
+		}
+		target, ok := labels[ins.function+"$"+ins.Arg1]
+		if !ok {
+			return fmt.Errorf("%s: undefined label %s", ins, ins.Arg1)
+		}
+		ins.target = target
+	}
+
+	if m.nextStatic > StackBase {
+		return fmt.Errorf("%s: the program needs %d static variables, but only %d fit", name, m.nextStatic-staticBase, StackBase-staticBase)
+	}
+	return nil
+}
+
+// static returns the address of static variable index of file name,
+// allocating it on first use.
+func (m *Machine) static(name string, index int) int {
+	key := name + "." + strconv.Itoa(index)
+	address, ok := m.statics[key]
+	if !ok {
+		address = m.nextStatic
+		m.statics[key] = address
+		m.nextStatic++
+	}
+	return address
+}
+
+// HasFunction reports whether the program defines function f.
+func (m *Machine) HasFunction(f string) bool {
+	_, ok := m.functions[f]
+	return ok
+}
+
+// Bootstrap sets up the stack and calls Sys.init, like the bootstrap code
+// written by the VM translator. If the program has no Sys.init of its own,
+// the one of the builtin OS runs instead: it initializes the OS and calls
+// Main.main, and the program halts when Main.main returns.
+func (m *Machine) Bootstrap() error {
+	m.Reset()
+	m.RAM[SP] = StackBase
+	if m.HasFunction("Sys.init") || m.jack == nil {
+		return m.call("Sys.init", 0, len(m.program))
+	}
+	if err := m.initOS(); err != nil {
+		return err
+	}
+	return m.call("Main.main", 0, len(m.program))
+}
+
+// Reset restarts the program from its first command. The RAM keeps its
+// values.
+func (m *Machine) Reset() {
+	m.PC = 0
+	m.Steps = 0
+	m.frames = nil
+	m.halted = false
+}
+
+// Halted reports whether the program ran past its last command or is stuck
+// in a loop that jumps back to itself, such as label END, goto END.
+func (m *Machine) Halted() bool {
+	return m.halted
+}
+
+// Function returns the name of the function being executed, if any.
+func (m *Machine) Function() string {
+	if len(m.frames) > 0 {
+		return m.frames[len(m.frames)-1].Function
+	}
+	if m.PC < len(m.program) {
+		return m.program[m.PC].function
+	}
+	return ""
+}
+
+// CallStack returns the active calls, innermost last.
+func (m *Machine) CallStack() []Frame {
+	return append([]Frame(nil), m.frames...)
+}
+
+// Current returns the command about to be executed, formatted with its file
+// and function.
+func (m *Machine) Current() string {
+	if m.PC < 0 || m.PC >= len(m.program) {
+		return fmt.Sprintf("end of program (%d)", m.PC)
+	}
+	return m.program[m.PC].String()
+}
+
+// Run executes at most n commands and stops early when the program halts.
+// It returns the number of commands executed.
+func (m *Machine) Run(n uint64) (uint64, error) {
+	var i uint64
+	for ; i < n && !m.halted; i++ {
+		if err := m.Step(); err != nil {
+			return i, err
+		}
+	}
+	return i, nil
+}
+
+// Step executes the command at PC.
+func (m *Machine) Step() error {
+	if m.halted {
+		return nil
+	}
+	if m.PC < 0 || m.PC >= len(m.program) {
+		m.halted = true
+		return nil
+	}
+	if m.Keys != nil {
+		m.RAM[emulator.Keyboard] = m.Keys.Key(m.Steps)
+	}
+
+	ins := m.program[m.PC]
+	if err := m.execute(ins); err != nil {
+		return fmt.Errorf("%s: %w", ins, err)
+	}
+	m.Steps++
+	return nil
+}
+
+func (m *Machine) execute(ins instruction) error {
+	next := m.PC + 1
+
+	switch ins.CommandType {
+	case vm.CArithmetic:
+		if err := m.arithmetic(ins.Name); err != nil {
+			return err
+		}
+	case vm.CPush:
+		address, err := m.address(ins)
+		if err != nil {
+			return err
+		}
+		v := uint16(ins.Arg2)
+		if address >= 0 {
+			v = m.RAM[address]
+		}
+		if err := m.push(v); err != nil {
+			return err
+		}
+	case vm.CPop:
+		if ins.Arg1 == "constant" {
+			return fmt.Errorf("cannot pop to the constant segment")
+		}
+		address, err := m.address(ins)
+		if err != nil {
+			return err
+		}
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.RAM[address] = v
+	case vm.CLabel:
+	case vm.CGoto:
+		if m.idleLoop(ins.target) {
+			m.halted = true
+		}
+		next = ins.target
+	case vm.CIfGoto:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			next = ins.target
+		}
+	case vm.CFunction:
+		for i := 0; i < ins.Arg2; i++ {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+	case vm.CCall:
+		if m.HasFunction(ins.Arg1) {
+			return m.call(ins.Arg1, ins.Arg2, next)
+		}
+		if err := m.callBuiltin(ins.Arg1, ins.Arg2); err != nil {
+			return err
+		}
+	case vm.CReturn:
+		return m.ret()
+	}
+
+	m.PC = next
+	return nil
+}
+
+// address returns the RAM address of a push or pop operand, or -1 for the
+// constant segment.
+func (m *Machine) address(ins instruction) (int, error) {
+	index := ins.Arg2
+	if index < 0 {
+		return 0, fmt.Errorf("negative index %d", index)
+	}
+
+	var address int
+	switch ins.Arg1 {
+	case "constant":
+		if index > 1<<15-1 {
+			return 0, fmt.Errorf("constant %d is not in range 0..%d", index, 1<<15-1)
+		}
+		return -1, nil
+	case "local":
+		address = int(m.RAM[LCL]) + index
+	case "argument":
+		address = int(m.RAM[ARG]) + index
+	case "this":
+		address = int(m.RAM[THIS]) + index
+	case "that":
+		address = int(m.RAM[THAT]) + index
+	case "pointer":
+		if index > 1 {
+			return 0, fmt.Errorf("pointer index %d is not 0 or 1", index)
+		}
+		address = THIS + index
+	case "temp":
+		if index >= tempSize {
+			return 0, fmt.Errorf("temp index %d is not in range 0..%d", index, tempSize-1)
+		}
+		address = tempBase + index
+	case "static":
+		address = ins.target
+	default:
+		return 0, fmt.Errorf("undefined segment: %s", ins.Arg1)
+	}
+
+	if address >= RAMSize {
+		return 0, fmt.Errorf("%s %d is address %d, outside of RAM", ins.Arg1, index, address)
+	}
+	return address, nil
+}
+
+func (m *Machine) push(v uint16) error {
+	sp := m.RAM[SP]
+	if int(sp) >= RAMSize {
+		return fmt.Errorf("stack overflow (SP=%d)", sp)
+	}
+	m.RAM[sp] = v
+	m.RAM[SP] = sp + 1
+	return nil
+}
+
+func (m *Machine) pop() (uint16, error) {
+	sp := m.RAM[SP]
+	if sp == 0 || int(sp) > RAMSize {
+		return 0, fmt.Errorf("stack underflow (SP=%d)", sp)
+	}
+	m.RAM[SP] = sp - 1
+	return m.RAM[sp-1], nil
+}
+
+func (m *Machine) arithmetic(command string) error {
+	y, err := m.pop()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "neg": // -y
+		return m.push(-y)
+	case "not": // !y
+		return m.push(^y)
+	}
+
+	x, err := m.pop()
+	if err != nil {
+		return err
+	}
+
+	var v uint16
+	switch command {
+	case "add": // x + y
+		v = x + y
+	case "sub": // x - y
+		v = x - y
+	case "and": // x & y
+		v = x & y
+	case "or": // x | y
+		v = x | y
+	case "eq":
+		v = truth(x == y)
+	case "gt":
+		v = truth(int16(x) > int16(y))
+	case "lt":
+		v = truth(int16(x) < int16(y))
+	default:
+		return fmt.Errorf("unknown command %s", command)
+	}
+	return m.push(v)
+}
+
+func truth(b bool) uint16 {
+	if b {
+		return 0xFFFF
+	}
+	return 0
+}
+
+// call saves the caller's frame and jumps to function f with the top n
+// stack values as its arguments.
+func (m *Machine) call(f string, n int, returnPC int) error {
+	target, ok := m.functions[f]
+	if !ok {
+		return fmt.Errorf("undefined function %s", f)
+	}
+
+	for _, v := range []uint16{uint16(returnPC), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if err := m.push(v); err != nil {
+			return err
+		}
+	}
+	m.RAM[ARG] = m.RAM[SP] - uint16(n) - 5
+	m.RAM[LCL] = m.RAM[SP]
+
+	m.frames = append(m.frames, Frame{Function: f, ReturnPC: returnPC})
+	m.PC = target
+	return nil
+}
+
+// ret returns the top of the stack to the caller and restores its frame.
+func (m *Machine) ret() error {
+	frame := m.RAM[LCL]
+	if frame < 5 || int(frame) > RAMSize {
+		return fmt.Errorf("return without a call frame (LCL=%d)", frame)
+	}
+	returnPC := m.RAM[frame-5]
+
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	m.RAM[m.RAM[ARG]&(RAMSize-1)] = v
+	m.RAM[SP] = m.RAM[ARG] + 1
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+
+	if len(m.frames) > 0 {
+		m.frames = m.frames[:len(m.frames)-1]
+	}
+	m.PC = int(returnPC)
+	return nil
+}
+
+// idleLoop reports whether jumping from PC to target repeats a loop that
+// can never end: one that only passes labels, or that computes its
+// conditions from constants alone and leaves the stack as it found it,
+// like the while (true) {} of a Sys.halt compiled from Jack. Having reached
+// the goto, such a loop takes it forever.
+func (m *Machine) idleLoop(target int) bool {
+	if target > m.PC {
+		return false
+	}
+	depth := 0
+	for pc := target; pc < m.PC; pc++ {
+		switch ins := m.program[pc]; ins.CommandType {
+		case vm.CLabel:
+		case vm.CPush:
+			if ins.Arg1 != "constant" {
+				return false
+			}
+			depth++
+		case vm.CArithmetic:
+			if ins.Name != "neg" && ins.Name != "not" {
+				depth--
+			}
+		case vm.CIfGoto:
+			depth--
+		default:
+			return false
+		}
+		if depth < 0 {
+			// the loop reads values pushed before it
+			return false
+		}
+	}
+	return depth == 0
+}
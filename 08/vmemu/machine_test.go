@@ -0,0 +1,291 @@
+package vmemu_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/08/vm"
+	"github.com/ebakazu/nand2tetris/08/vmemu"
+)
+
+// TestTestcases runs the programs of the tests of chapters 07 and 08 with
+// the RAM their test scripts set and checks the values of their .cmp files.
+func TestTestcases(t *testing.T) {
+	tests := []struct {
+		dir  string
+		set  map[int]int16
+		want map[int]int16
+	}{
+		{
+			"../../07/testcases/StackArithmetic/SimpleAdd",
+			map[int]int16{0: 256},
+			map[int]int16{0: 257, 256: 15},
+		},
+		{
+			"../../07/testcases/StackArithmetic/StackTest",
+			map[int]int16{0: 256},
+			map[int]int16{0: 266, 256: -1, 257: 0, 258: 0, 259: 0, 260: -1, 261: 0, 262: -1, 263: 0, 264: 0, 265: -91},
+		},
+		{
+			"../../07/testcases/MemoryAccess/BasicTest",
+			map[int]int16{0: 256, 1: 300, 2: 400, 3: 3000, 4: 3010},
+			map[int]int16{256: 472, 300: 10, 401: 21, 402: 22, 3006: 36, 3012: 42, 3015: 45, 11: 510},
+		},
+		{
+			"../../07/testcases/MemoryAccess/PointerTest",
+			map[int]int16{0: 256},
+			map[int]int16{256: 6084, 3: 3030, 4: 3040, 3032: 32, 3046: 46},
+		},
+		{
+			"../../07/testcases/MemoryAccess/StaticTest",
+			map[int]int16{0: 256},
+			map[int]int16{256: 1110},
+		},
+		{
+			"../../08/testcases/ProgramFlow/BasicLoop",
+			map[int]int16{0: 256, 1: 300, 2: 400, 400: 3},
+			map[int]int16{0: 257, 256: 6},
+		},
+		{
+			"../../08/testcases/ProgramFlow/FibonacciSeries",
+			map[int]int16{0: 256, 1: 300, 2: 400, 400: 6, 401: 3000},
+			map[int]int16{3000: 0, 3001: 1, 3002: 1, 3003: 2, 3004: 3, 3005: 5},
+		},
+		{
+			"../../08/testcases/FunctionCalls/SimpleFunction",
+			map[int]int16{0: 317, 1: 317, 2: 310, 3: 3000, 4: 4000, 310: 1234, 311: 37, 312: 1000, 313: 305, 314: 300, 315: 3010, 316: 4010},
+			map[int]int16{0: 311, 1: 305, 2: 300, 3: 3010, 4: 4010, 310: 1196},
+		},
+		{
+			"../../08/testcases/FunctionCalls/FibonacciElement",
+			nil,
+			map[int]int16{0: 262, 261: 3},
+		},
+		{
+			"../../08/testcases/FunctionCalls/StaticsTest",
+			nil,
+			map[int]int16{0: 263, 261: -2, 262: 8},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(filepath.Base(test.dir), func(t *testing.T) {
+			m := vmemu.New()
+			locs, err := filepath.Glob(filepath.Join(test.dir, "*.vm"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, loc := range locs {
+				loadVM(t, m, strings.TrimSuffix(filepath.Base(loc), ".vm"), readFile(t, loc))
+			}
+			if m.HasFunction("Sys.init") {
+				if err := m.Bootstrap(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for address, v := range test.set {
+				m.RAM[address] = uint16(v)
+			}
+
+			n, err := m.Run(100000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !m.Halted() {
+				t.Fatalf("stopped after %d steps in %s", n, m.Current())
+			}
+			for address, want := range test.want {
+				if got := int16(m.RAM[address]); got != want {
+					t.Errorf("RAM[%d] is %d, want %d", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		halts bool
+		steps uint64
+	}{
+		{"end of program", "push constant 1\npush constant 2\nadd", true, 3},
+		{"end loop", "push constant 7\nlabel END\ngoto END", true, 3},
+		{"while true", "label WHILE\npush constant 0\nnot\nnot\nif-goto END\ngoto WHILE\nlabel END", true, 6},
+		{"counter", "label LOOP\npush temp 0\npush constant 1\nadd\npop temp 0\ngoto LOOP", false, 0},
+		{"keyboard", "label LOOP\npush constant 24576\npop pointer 1\npush that 0\nif-goto END\ngoto LOOP\nlabel END", false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := vmemu.New()
+			m.RAM[vmemu.SP] = vmemu.StackBase
+			loadVM(t, m, "Prog", test.src)
+			if _, err := m.Run(1000); err != nil {
+				t.Fatal(err)
+			}
+			if m.Halted() != test.halts {
+				t.Fatalf("got halted %v after %d steps, want %v", m.Halted(), m.Steps, test.halts)
+			}
+			if test.halts && m.Steps != test.steps {
+				t.Errorf("halted after %d steps, want %d", m.Steps, test.steps)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"function A.f 0\nreturn", "function A.f 0\nreturn"}, "F1: function A.f is already defined"},
+		{[]string{"function A.f 0\nlabel L\nlabel L"}, "F0: label A.f$L is already defined"},
+		{[]string{"function A.f 0\ngoto L"}, "F0: A.f: goto L: undefined label L"},
+		{[]string{"function A.f 0\nlabel L\nreturn\nfunction A.g 0\ngoto L"}, "F0: A.g: goto L: undefined label L"},
+		{[]string{statics(100), statics(141)}, "F1: the program needs 241 static variables, but only 240 fit"},
+	}
+
+	for _, test := range tests {
+		m := vmemu.New()
+		var err error
+		for i, src := range test.files {
+			if err = m.Load("F"+string(rune('0'+i)), parse(t, src)); err != nil {
+				break
+			}
+		}
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got %v, want %s", test.files, err, test.want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"pop constant 1", "Prog: pop constant 1: cannot pop to the constant segment"},
+		{"push pointer 2", "Prog: push pointer 2: pointer index 2 is not 0 or 1"},
+		{"push temp 8", "Prog: push temp 8: temp index 8 is not in range 0..7"},
+		{"push constant 32767\npop pointer 0\npush this 10", "Prog: push this 10: this 10 is address 32777, outside of RAM"},
+		{"push nowhere 0", "Prog: push nowhere 0: undefined segment: nowhere"},
+		// THAT points to SP, so pop that 0 empties the stack
+		{"push constant 0\npop pointer 1\npush constant 0\npop that 0\nadd", "Prog: add: stack underflow (SP=0)"},
+		{"call Nowhere.f 0", "Prog: call Nowhere.f 0: undefined function Nowhere.f"},
+		{"function A.f 0\nreturn", "Prog: A.f: return: return without a call frame (LCL=0)"},
+	}
+
+	for _, test := range tests {
+		m := vmemu.New()
+		m.RAM[vmemu.SP] = vmemu.StackBase
+		loadVM(t, m, "Prog", test.src)
+		_, err := m.Run(100)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got %v, want %s", test.src, err, test.want)
+		}
+	}
+}
+
+func TestCallStack(t *testing.T) {
+	src := `function Main.main 0
+push constant 3
+call Main.twice 1
+return
+function Main.twice 0
+push argument 0
+push argument 0
+add
+return`
+	m := vmemu.New()
+	loadVM(t, m, "Main", src)
+	m.RAM[vmemu.SP] = vmemu.StackBase
+
+	for m.Function() != "Main.twice" {
+		if err := m.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if m.Halted() {
+			t.Fatal("halted before calling Main.twice")
+		}
+	}
+	frames := m.CallStack()
+	if len(frames) != 1 || frames[0].Function != "Main.twice" || frames[0].ReturnPC != 3 {
+		t.Errorf("got call stack %+v, want Main.twice returning to 3", frames)
+	}
+	if got, want := m.Current(), "Main: Main.twice: function Main.twice 0"; got != want {
+		t.Errorf("Current() = %q, want %q", got, want)
+	}
+}
+
+func TestCall(t *testing.T) {
+	src := `function Main.sum 0
+push argument 0
+push argument 1
+call Host.double 1
+add
+return`
+	m := vmemu.New()
+	loadVM(t, m, "Main", src)
+	m.RAM[vmemu.SP] = vmemu.StackBase
+	m.Define("Host.double", 1, func(m *vmemu.Machine, args []uint16) (uint16, error) {
+		return 2 * args[0], nil
+	})
+
+	v, err := m.Call("Main.sum", 5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 13 {
+		t.Errorf("Main.sum(5, 4) = %d, want 13", v)
+	}
+	if m.RAM[vmemu.SP] != vmemu.StackBase {
+		t.Errorf("SP is %d after the call, want %d", m.RAM[vmemu.SP], vmemu.StackBase)
+	}
+
+	if _, err := m.Call("Host.double"); err == nil || err.Error() != "Host.double takes 1 arguments, but is called with 0" {
+		t.Errorf("got %v, want an error about the number of arguments", err)
+	}
+	if _, err := m.Call("Host.nothing"); err == nil || err.Error() != "undefined function Host.nothing" {
+		t.Errorf("got %v, want an undefined function", err)
+	}
+}
+
+// loadVM parses src and loads it as file name.
+func loadVM(t *testing.T, m *vmemu.Machine, name string, src string) {
+	t.Helper()
+	if err := m.Load(name, parse(t, src)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parse(t *testing.T, src string) []vm.Command {
+	t.Helper()
+	cmds, err := vm.NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmds
+}
+
+// statics returns a file that uses n static variables.
+func statics(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "push static %d\n", i)
+	}
+	return b.String()
+}
+
+func readFile(t *testing.T, loc string) string {
+	t.Helper()
+	src, err := os.ReadFile(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(src)
+}
@@ -0,0 +1,363 @@
+package vmemu
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Error codes of Sys.error, as listed in the Jack OS API.
+const (
+	errWaitDuration   = 1
+	errArraySize      = 2
+	errDivideByZero   = 3
+	errSqrtNegative   = 4
+	errAllocSize      = 5
+	errHeapOverflow   = 6
+	errPixel          = 7
+	errLine           = 8
+	errRectangle      = 9
+	errCircleCenter   = 12
+	errCircleRadius   = 13
+	errStringLength   = 14
+	errCharAt         = 15
+	errSetCharAt      = 16
+	errStringFull     = 17
+	errStringEmpty    = 18
+	errStringCapacity = 19
+	errCursor         = 20
+)
+
+const (
+	heapBase = 2048
+	heapEnd  = 16384
+
+	newLine     = 128
+	backSpace   = 129
+	doubleQuote = '"'
+
+	// readLineLength is the capacity of strings returned by Keyboard.readLine.
+	readLineLength = 80
+)
+
+// SysError is the error a program stops with when it calls Sys.error of the
+// builtin OS.
+type SysError struct {
+	Code int
+}
+
+func (e *SysError) Error() string {
+	return fmt.Sprintf("Sys.error(%d)", e.Code)
+}
+
+type block struct {
+	address int
+	size    int
+}
+
+// jackOS holds the state of the builtin OS classes.
+type jackOS struct {
+	free  []block     // free heap blocks, sorted by address
+	used  map[int]int // sizes of allocated blocks
+	row   int
+	col   int
+	black bool
+}
+
+// InstallOS defines the eight classes of the Jack OS (Math, String, Array,
+// Output, Screen, Keyboard, Memory and Sys) as builtins. Classes loaded from
+// .vm files replace them function by function, and the builtins call each
+// other through Call, so a replaced class is used by the others as well.
+//
+// Sys.wait returns immediately, and Keyboard functions that wait for a key
+// advance Steps to the next change of the Keys script.
+func (m *Machine) InstallOS() {
+	m.jack = &jackOS{}
+	m.installSys()
+	m.installMemory()
+	m.installArray()
+	m.installMath()
+	m.installString()
+	m.installOutput()
+	m.installScreen()
+	m.installKeyboard()
+}
+
+// initOS does what Sys.init does before it calls Main.main.
+func (m *Machine) initOS() error {
+	for _, f := range []string{"Memory.init", "Math.init", "Screen.init", "Output.init", "Keyboard.init"} {
+		if _, err := m.Call(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peek and poke access RAM at address, wrapping around like the Hack
+// computer instead of failing on addresses computed from bad pointers.
+func (m *Machine) peek(address uint16) uint16 {
+	return m.RAM[address&(RAMSize-1)]
+}
+
+func (m *Machine) poke(address uint16, v uint16) {
+	m.RAM[address&(RAMSize-1)] = v
+}
+
+// sysError reports error code through Sys.error.
+func (m *Machine) sysError(code int) (uint16, error) {
+	if _, err := m.Call("Sys.error", uint16(code)); err != nil {
+		return 0, err
+	}
+	// a Sys.error written in VM code halts the program
+	return 0, nil
+}
+
+func (m *Machine) installSys() {
+	m.Define("Sys.init", 0, func(m *Machine, args []uint16) (uint16, error) {
+		if err := m.initOS(); err != nil {
+			return 0, err
+		}
+		if _, err := m.Call("Main.main"); err != nil {
+			return 0, err
+		}
+		return m.Call("Sys.halt")
+	})
+	m.Define("Sys.halt", 0, func(m *Machine, args []uint16) (uint16, error) {
+		m.halted = true
+		return 0, nil
+	})
+	m.Define("Sys.error", 1, func(m *Machine, args []uint16) (uint16, error) {
+		for _, c := range fmt.Sprintf("ERR%d", int16(args[0])) {
+			if _, err := m.Call("Output.printChar", uint16(c)); err != nil {
+				return 0, err
+			}
+		}
+		m.halted = true
+		return 0, &SysError{Code: int(int16(args[0]))}
+	})
+	m.Define("Sys.wait", 1, func(m *Machine, args []uint16) (uint16, error) {
+		if int16(args[0]) < 0 {
+			return m.sysError(errWaitDuration)
+		}
+		return 0, nil
+	})
+}
+
+func (m *Machine) installMemory() {
+	m.Define("Memory.init", 0, func(m *Machine, args []uint16) (uint16, error) {
+		m.jack.free = []block{{address: heapBase, size: heapEnd - heapBase}}
+		m.jack.used = map[int]int{}
+		return 0, nil
+	})
+	m.Define("Memory.peek", 1, func(m *Machine, args []uint16) (uint16, error) {
+		return m.peek(args[0]), nil
+	})
+	m.Define("Memory.poke", 2, func(m *Machine, args []uint16) (uint16, error) {
+		m.poke(args[0], args[1])
+		return 0, nil
+	})
+	m.Define("Memory.alloc", 1, func(m *Machine, args []uint16) (uint16, error) {
+		size := int(int16(args[0]))
+		if size <= 0 {
+			return m.sysError(errAllocSize)
+		}
+		if m.jack.used == nil {
+			// the program calls Memory.alloc without Memory.init
+			m.jack.free = []block{{address: heapBase, size: heapEnd - heapBase}}
+			m.jack.used = map[int]int{}
+		}
+		for i, b := range m.jack.free {
+			if b.size < size {
+				continue
+			}
+			if b.size == size {
+				m.jack.free = append(m.jack.free[:i], m.jack.free[i+1:]...)
+			} else {
+				m.jack.free[i] = block{address: b.address + size, size: b.size - size}
+			}
+			m.jack.used[b.address] = size
+			return uint16(b.address), nil
+		}
+		return m.sysError(errHeapOverflow)
+	})
+	m.Define("Memory.deAlloc", 1, func(m *Machine, args []uint16) (uint16, error) {
+		address := int(args[0])
+		size, ok := m.jack.used[address]
+		if !ok {
+			return 0, fmt.Errorf("Memory.deAlloc: %d is not an allocated block", address)
+		}
+		delete(m.jack.used, address)
+
+		free := append(m.jack.free, block{address: address, size: size})
+		sort.Slice(free, func(i, j int) bool { return free[i].address < free[j].address })
+		merged := free[:1]
+		for _, b := range free[1:] {
+			last := &merged[len(merged)-1]
+			if last.address+last.size == b.address {
+				last.size += b.size
+				continue
+			}
+			merged = append(merged, b)
+		}
+		m.jack.free = merged
+		return 0, nil
+	})
+}
+
+func (m *Machine) installArray() {
+	m.Define("Array.new", 1, func(m *Machine, args []uint16) (uint16, error) {
+		if int16(args[0]) <= 0 {
+			return m.sysError(errArraySize)
+		}
+		return m.Call("Memory.alloc", args[0])
+	})
+	m.Define("Array.dispose", 1, func(m *Machine, args []uint16) (uint16, error) {
+		return m.Call("Memory.deAlloc", args[0])
+	})
+}
+
+func (m *Machine) installMath() {
+	m.Define("Math.init", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return 0, nil
+	})
+	m.Define("Math.abs", 1, func(m *Machine, args []uint16) (uint16, error) {
+		if x := int16(args[0]); x < 0 {
+			return uint16(-x), nil
+		}
+		return args[0], nil
+	})
+	m.Define("Math.multiply", 2, func(m *Machine, args []uint16) (uint16, error) {
+		return args[0] * args[1], nil
+	})
+	m.Define("Math.divide", 2, func(m *Machine, args []uint16) (uint16, error) {
+		x, y := int16(args[0]), int16(args[1])
+		if y == 0 {
+			return m.sysError(errDivideByZero)
+		}
+		if y == -1 {
+			return uint16(-x), nil // -32768 / -1 overflows as in Jack
+		}
+		return uint16(x / y), nil
+	})
+	m.Define("Math.min", 2, func(m *Machine, args []uint16) (uint16, error) {
+		if int16(args[0]) < int16(args[1]) {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+	m.Define("Math.max", 2, func(m *Machine, args []uint16) (uint16, error) {
+		if int16(args[0]) > int16(args[1]) {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+	m.Define("Math.sqrt", 1, func(m *Machine, args []uint16) (uint16, error) {
+		x := int(int16(args[0]))
+		if x < 0 {
+			return m.sysError(errSqrtNegative)
+		}
+		y := 0
+		for (y+1)*(y+1) <= x {
+			y++
+		}
+		return uint16(y), nil
+	})
+}
+
+// Strings are blocks of maxLength+2 words: the maximum length, the length
+// and the characters.
+func (m *Machine) installString() {
+	m.Define("String.new", 1, func(m *Machine, args []uint16) (uint16, error) {
+		maxLength := int16(args[0])
+		if maxLength < 0 {
+			return m.sysError(errStringLength)
+		}
+		s, err := m.Call("Memory.alloc", uint16(maxLength)+2)
+		if err != nil || m.halted {
+			return 0, err
+		}
+		m.poke(s, uint16(maxLength))
+		m.poke(s+1, 0)
+		return s, nil
+	})
+	m.Define("String.dispose", 1, func(m *Machine, args []uint16) (uint16, error) {
+		return m.Call("Memory.deAlloc", args[0])
+	})
+	m.Define("String.length", 1, func(m *Machine, args []uint16) (uint16, error) {
+		return m.peek(args[0] + 1), nil
+	})
+	m.Define("String.charAt", 2, func(m *Machine, args []uint16) (uint16, error) {
+		s, j := args[0], args[1]
+		if int16(j) < 0 || j >= m.peek(s+1) {
+			return m.sysError(errCharAt)
+		}
+		return m.peek(s + 2 + j), nil
+	})
+	m.Define("String.setCharAt", 3, func(m *Machine, args []uint16) (uint16, error) {
+		s, j := args[0], args[1]
+		if int16(j) < 0 || j >= m.peek(s+1) {
+			return m.sysError(errSetCharAt)
+		}
+		m.poke(s+2+j, args[2])
+		return 0, nil
+	})
+	m.Define("String.appendChar", 2, func(m *Machine, args []uint16) (uint16, error) {
+		s := args[0]
+		length := m.peek(s + 1)
+		if length >= m.peek(s) {
+			return m.sysError(errStringFull)
+		}
+		m.poke(s+2+length, args[1])
+		m.poke(s+1, length+1)
+		return s, nil
+	})
+	m.Define("String.eraseLastChar", 1, func(m *Machine, args []uint16) (uint16, error) {
+		s := args[0]
+		if m.peek(s+1) == 0 {
+			return m.sysError(errStringEmpty)
+		}
+		m.poke(s+1, m.peek(s+1)-1)
+		return 0, nil
+	})
+	m.Define("String.intValue", 1, func(m *Machine, args []uint16) (uint16, error) {
+		s := args[0]
+		length := m.peek(s + 1)
+		var v uint16
+		negative := false
+		for i := uint16(0); i < length; i++ {
+			c := m.peek(s + 2 + i)
+			if i == 0 && c == '-' {
+				negative = true
+				continue
+			}
+			if c < '0' || c > '9' {
+				break
+			}
+			v = v*10 + c - '0'
+		}
+		if negative {
+			v = -v
+		}
+		return v, nil
+	})
+	m.Define("String.setInt", 2, func(m *Machine, args []uint16) (uint16, error) {
+		s := args[0]
+		digits := fmt.Sprintf("%d", int16(args[1]))
+		if len(digits) > int(m.peek(s)) {
+			return m.sysError(errStringCapacity)
+		}
+		for i, c := range digits {
+			m.poke(s+2+uint16(i), uint16(c))
+		}
+		m.poke(s+1, uint16(len(digits)))
+		return 0, nil
+	})
+	m.Define("String.newLine", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return newLine, nil
+	})
+	m.Define("String.backSpace", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return backSpace, nil
+	})
+	m.Define("String.doubleQuote", 0, func(m *Machine, args []uint16) (uint16, error) {
+		return doubleQuote, nil
+	})
+}
@@ -0,0 +1,232 @@
+package vmemu_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/08/vmemu"
+	"github.com/ebakazu/nand2tetris/11/jackc"
+)
+
+// osModes run programs with the builtin OS alone and with classes of the
+// Jack OS of chapter 12 replacing some of it.
+var osModes = []struct {
+	name    string
+	classes []string
+}{
+	{"builtin", nil},
+	{"jack", []string{"Math", "String", "Array", "Memory", "Output", "Screen", "Keyboard"}},
+}
+
+func TestOS(t *testing.T) {
+	main := `class Main {
+    function void main() {
+        var String s;
+        var Array a, b;
+        do Memory.poke(8000, Math.multiply(-6, 7));
+        do Memory.poke(8001, Math.divide(-43, 5));
+        do Memory.poke(8002, Math.sqrt(1000));
+        do Memory.poke(8003, Math.min(3, -2));
+        do Memory.poke(8004, Math.max(3, -2));
+        do Memory.poke(8005, Math.abs(-5));
+        let s = String.new(6);
+        do s.setInt(-123);
+        do s.appendChar(52);
+        do Memory.poke(8006, s.length());
+        do Memory.poke(8007, s.intValue());
+        do s.eraseLastChar();
+        do Memory.poke(8008, s.charAt(3));
+        let s = "hello";
+        do Memory.poke(8009, s.length());
+        let a = Array.new(10);
+        do a.dispose();
+        let b = Array.new(4);
+        // the freed block is reused
+        do Memory.poke(8010, ~(b < a) & (b < (a + 10)));
+        return;
+    }
+}`
+	want := []int16{-42, -8, 31, -2, 3, 5, 5, -1234, '3', 5, -1}
+
+	for _, mode := range osModes {
+		t.Run(mode.name, func(t *testing.T) {
+			m := runJack(t, main, nil, mode.classes...)
+			for i, v := range want {
+				if got := int16(m.RAM[8000+i]); got != v {
+					t.Errorf("RAM[%d] is %d, want %d", 8000+i, got, v)
+				}
+			}
+		})
+	}
+}
+
+// TestScreen compares what the builtin OS draws with the drawing of the
+// Jack OS.
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"text", `do Output.printString("Hello, World!"); do Output.println(); do Output.printInt(-1234);`},
+		{"cursor", `do Output.moveCursor(22, 63); do Output.printChar(65); do Output.printChar(66);`},
+		{"backspace", `do Output.printString("abc"); do Output.backSpace(); do Output.printChar(String.backSpace());`},
+		{"pixels", `do Screen.drawPixel(0, 0); do Screen.drawPixel(511, 255); do Screen.drawPixel(17, 100);`},
+		{"lines", `do Screen.drawLine(0, 0, 511, 0); do Screen.drawLine(10, 200, 10, 20); do Screen.drawLine(300, 30, 290, 30);`},
+		{"rectangle", `do Screen.drawRectangle(3, 5, 100, 90); do Screen.setColor(false); do Screen.drawRectangle(20, 20, 30, 30);`},
+		{"circle", `do Screen.drawCircle(256, 128, 50); do Screen.drawCircle(0, 0, 10);`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			main := fmt.Sprintf("class Main { function void main() { %s return; } }", test.code)
+			builtin := runJack(t, main, nil)
+			jack := runJack(t, main, nil, "Math", "String", "Array", "Memory", "Output", "Screen")
+
+			blank := true
+			for i := emulator.Screen; i < emulator.Screen+emulator.ScreenSize; i++ {
+				if builtin.RAM[i] != jack.RAM[i] {
+					t.Fatalf("RAM[%d] is %016b, want %016b", i, builtin.RAM[i], jack.RAM[i])
+				}
+				blank = blank && builtin.RAM[i] == 0
+			}
+			if blank {
+				t.Error("nothing was drawn")
+			}
+		})
+	}
+}
+
+// TestDrawLine checks a slanted line, which the Jack OS draws as a staircase
+// and the builtin OS with Bresenham's algorithm.
+func TestDrawLine(t *testing.T) {
+	m := runJack(t, "class Main { function void main() { do Screen.drawLine(1, 0, 7, 2); return; } }", nil)
+	want := []uint16{0b110, 0b111000, 0b11000000}
+	for i, v := range want {
+		if got := m.RAM[emulator.Screen+i*emulator.ScreenWidth/16]; got != v {
+			t.Errorf("row %d is %016b, want %016b", i, got, v)
+		}
+	}
+}
+
+func TestSysError(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{"do Array.new(0);", 2},
+		{"do Math.divide(1, 0);", 3},
+		{"do Math.sqrt(-1);", 4},
+		{"do Memory.alloc(0);", 5},
+		{"do Memory.alloc(20000);", 6},
+		{"do Screen.drawPixel(512, 0);", 7},
+		{"do Screen.drawLine(0, 0, 0, 256);", 8},
+		{"do Screen.drawRectangle(10, 0, 0, 10);", 9},
+		{"do Screen.drawCircle(-1, 0, 1);", 12},
+		{"do Screen.drawCircle(100, 100, 182);", 13},
+		{"do String.new(-1);", 14},
+		{`let s = "ab"; do s.charAt(2);`, 15},
+		{`let s = "ab"; do s.setCharAt(-1, 32);`, 16},
+		{`let s = "ab"; do s.appendChar(32);`, 17},
+		{"let s = String.new(1); do s.eraseLastChar();", 18},
+		{"let s = String.new(2); do s.setInt(-10);", 19},
+		{"do Output.moveCursor(23, 0);", 20},
+	}
+
+	for _, test := range tests {
+		main := fmt.Sprintf("class Main { function void main() { var String s; %s return; } }", test.code)
+		m := boot(t, main, nil)
+		_, err := m.Run(100000)
+		var sysErr *vmemu.SysError
+		if !errors.As(err, &sysErr) {
+			t.Errorf("%s: got %v, want Sys.error(%d)", test.code, err, test.want)
+			continue
+		}
+		if sysErr.Code != test.want {
+			t.Errorf("%s: got Sys.error(%d), want Sys.error(%d)", test.code, sysErr.Code, test.want)
+		}
+		if !m.Halted() {
+			t.Errorf("%s: not halted after Sys.error", test.code)
+		}
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	main := `class Main {
+    function void main() {
+        do Memory.poke(8000, Keyboard.readInt("? "));
+        do Memory.poke(8001, Keyboard.readChar());
+        return;
+    }
+}`
+	// keystrokes are far apart, for the Jack OS prints each character
+	// it reads
+	keys := emulator.NewKeyScript([]emulator.Keystroke{
+		{Key: '1', Start: 100000, Duration: 1000},
+		{Key: '3', Start: 200000, Duration: 1000},
+		{Key: emulator.KeyBackspace, Start: 300000, Duration: 1000},
+		{Key: '2', Start: 400000, Duration: 1000},
+		{Key: emulator.KeyNewline, Start: 500000, Duration: 1000},
+		{Key: 'x', Start: 600000, Duration: 1000},
+	})
+
+	for _, mode := range osModes {
+		t.Run(mode.name, func(t *testing.T) {
+			m := runJack(t, main, keys, mode.classes...)
+			if got := int16(m.RAM[8000]); got != 12 {
+				t.Errorf("readInt returned %d, want 12", got)
+			}
+			if got := m.RAM[8001]; got != 'x' {
+				t.Errorf("readChar returned %d, want %d", got, 'x')
+			}
+		})
+	}
+
+	m := boot(t, main, nil)
+	want := "waiting for the keyboard, but there is no keystroke script"
+	if _, err := m.Run(100000); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("got %v, want an error ending in %q", err, want)
+	}
+}
+
+// runJack runs the Jack class Main with the builtin OS until it halts.
+// classes names the classes of the Jack OS of chapter 12 that replace the
+// builtin ones.
+func runJack(t *testing.T, main string, keys *emulator.KeyScript, classes ...string) *vmemu.Machine {
+	t.Helper()
+	m := boot(t, main, keys, classes...)
+	if _, err := m.Run(100000000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted() {
+		t.Fatalf("stopped after %d steps in %s", m.Steps, m.Current())
+	}
+	return m
+}
+
+func boot(t *testing.T, main string, keys *emulator.KeyScript, classes ...string) *vmemu.Machine {
+	t.Helper()
+	m := vmemu.New()
+	m.InstallOS()
+	m.Keys = keys
+	loadJack(t, m, "Main", main)
+	for _, class := range classes {
+		loadJack(t, m, class, readFile(t, "../../12/"+class+".jack"))
+	}
+	if err := m.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func loadJack(t *testing.T, m *vmemu.Machine, name string, src string) {
+	t.Helper()
+	var code bytes.Buffer
+	if err := jackc.Compile(&code, []byte(src)); err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	loadVM(t, m, name, code.String())
+}
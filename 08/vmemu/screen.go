@@ -0,0 +1,127 @@
+package vmemu
+
+import (
+	"github.com/ebakazu/nand2tetris/05/emulator"
+)
+
+func (m *Machine) installScreen() {
+	m.Define("Screen.init", 0, func(m *Machine, args []uint16) (uint16, error) {
+		m.jack.black = true
+		return 0, nil
+	})
+	m.Define("Screen.clearScreen", 0, func(m *Machine, args []uint16) (uint16, error) {
+		for i := 0; i < emulator.ScreenSize; i++ {
+			m.RAM[emulator.Screen+i] = 0
+		}
+		return 0, nil
+	})
+	m.Define("Screen.setColor", 1, func(m *Machine, args []uint16) (uint16, error) {
+		m.jack.black = args[0] != 0
+		return 0, nil
+	})
+	m.Define("Screen.drawPixel", 2, func(m *Machine, args []uint16) (uint16, error) {
+		x, y := int(int16(args[0])), int(int16(args[1]))
+		if !onScreen(x, y) {
+			return m.sysError(errPixel)
+		}
+		m.drawPixel(x, y)
+		return 0, nil
+	})
+	m.Define("Screen.drawLine", 4, func(m *Machine, args []uint16) (uint16, error) {
+		x1, y1, x2, y2 := int(int16(args[0])), int(int16(args[1])), int(int16(args[2])), int(int16(args[3]))
+		if !onScreen(x1, y1) || !onScreen(x2, y2) {
+			return m.sysError(errLine)
+		}
+		m.drawLine(x1, y1, x2, y2)
+		return 0, nil
+	})
+	m.Define("Screen.drawRectangle", 4, func(m *Machine, args []uint16) (uint16, error) {
+		x1, y1, x2, y2 := int(int16(args[0])), int(int16(args[1])), int(int16(args[2])), int(int16(args[3]))
+		if !onScreen(x1, y1) || !onScreen(x2, y2) || x1 > x2 || y1 > y2 {
+			return m.sysError(errRectangle)
+		}
+		for y := y1; y <= y2; y++ {
+			m.drawHorizontal(x1, x2, y)
+		}
+		return 0, nil
+	})
+	m.Define("Screen.drawCircle", 3, func(m *Machine, args []uint16) (uint16, error) {
+		x, y, r := int(int16(args[0])), int(int16(args[1])), int(int16(args[2]))
+		if !onScreen(x, y) {
+			return m.sysError(errCircleCenter)
+		}
+		if r < 0 || r > 181 {
+			return m.sysError(errCircleRadius)
+		}
+		for dy := -r; dy <= r; dy++ {
+			dx := 0
+			for (dx+1)*(dx+1) <= r*r-dy*dy {
+				dx++
+			}
+			if y+dy >= 0 && y+dy < emulator.ScreenHeight {
+				m.drawHorizontal(clamp(x-dx, emulator.ScreenWidth-1), clamp(x+dx, emulator.ScreenWidth-1), y+dy)
+			}
+		}
+		return 0, nil
+	})
+}
+
+func onScreen(x int, y int) bool {
+	return x >= 0 && x < emulator.ScreenWidth && y >= 0 && y < emulator.ScreenHeight
+}
+
+func clamp(v int, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// drawPixel sets the pixel at x, y to the current color.
+func (m *Machine) drawPixel(x int, y int) {
+	address := emulator.Screen + y*emulator.ScreenWidth/16 + x/16
+	bit := uint16(1) << uint(x%16)
+	if m.jack.black {
+		m.RAM[address] |= bit
+	} else {
+		m.RAM[address] &^= bit
+	}
+}
+
+func (m *Machine) drawHorizontal(x1 int, x2 int, y int) {
+	for x := x1; x <= x2; x++ {
+		m.drawPixel(x, y)
+	}
+}
+
+// drawLine draws the line from x1, y1 to x2, y2 with Bresenham's algorithm.
+func (m *Machine) drawLine(x1 int, y1 int, x2 int, y2 int) {
+	dx, sx := x2-x1, 1
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+	dy, sy := y2-y1, 1
+	if dy < 0 {
+		dy, sy = -dy, -1
+	}
+
+	diff := dx - dy
+	for {
+		m.drawPixel(x1, y1)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e := 2 * diff
+		if e > -dy {
+			diff -= dy
+			x1 += sx
+		}
+		if e < dx {
+			diff += dx
+			y1 += sy
+		}
+	}
+}
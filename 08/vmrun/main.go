@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ebakazu/nand2tetris/05/emulator"
+	"github.com/ebakazu/nand2tetris/08/vm"
+	"github.com/ebakazu/nand2tetris/08/vmemu"
+)
+
+func main() {
+	steps := flag.Uint64("steps", 10000000, "maximum number of VM commands to execute")
+	set := flag.String("set", "", "comma-separated RAM initializations, e.g. 0=256,1=300")
+	dump := flag.String("dump", "0-4", "comma-separated RAM addresses or ranges to print, e.g. 0-4,256")
+	trace := flag.Bool("trace", false, "print every command before executing it")
+	useOS := flag.Bool("os", true, "provide the Jack OS classes not defined by the program")
+	screen := flag.String("screen", "", "write the screen to this PNG file when the program halts or stops")
+	keys := flag.String("keys", "", "file of timed keystrokes (key start step duration) that drive the keyboard")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-steps n] [-set addr=value,...] [-dump ranges] [-trace] [-os=false] [-screen file.png] [-keys file] file.vm ... | directory\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var locs []string
+	for _, fPath := range flag.Args() {
+		fInfo, err := os.Stat(fPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fInfo.IsDir() {
+			fInfos, err := ioutil.ReadDir(fPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			locs = append(locs, pickVMFileLocations(fInfos, fPath)...)
+		} else {
+			locs = append(locs, fPath)
+		}
+	}
+
+	m := vmemu.New()
+	if *useOS {
+		m.InstallOS()
+	}
+	for _, loc := range locs {
+		cmds, err := parse(loc)
+		if err != nil {
+			log.Fatalf("%s: %s", loc, err)
+		}
+		if err := m.Load(strings.TrimSuffix(path.Base(loc), ".vm"), cmds); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *keys != "" {
+		script, err := readKeyScript(*keys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Keys = script
+	}
+
+	// like the VM emulator of the course, programs without Sys.init, or
+	// Main.main for the builtin OS, start at their first command with the
+	// RAM set up by the user
+	if m.HasFunction("Sys.init") || *useOS && m.HasFunction("Main.main") {
+		if err := m.Bootstrap(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := setRAM(m, *set); err != nil {
+		log.Fatal(err)
+	}
+
+	n, err := run(m, *steps, *trace)
+	if *screen != "" {
+		if err := writeScreen(m, *screen); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		frames := m.CallStack()
+		for i := len(frames) - 1; i >= 0; i-- {
+			fmt.Fprintf(os.Stderr, "\tin %s\n", frames[i].Function)
+		}
+		os.Exit(1)
+	}
+	if m.Halted() {
+		fmt.Printf("halted after %d steps\n", n)
+	} else {
+		fmt.Printf("stopped after %d steps in %s\n", n, m.Current())
+	}
+
+	if err := dumpRAM(m, *dump); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parse(loc string) ([]vm.Command, error) {
+	file, err := os.Open(loc)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return vm.NewParser(file).Parse()
+}
+
+func run(m *vmemu.Machine, n uint64, trace bool) (uint64, error) {
+	if !trace {
+		return m.Run(n)
+	}
+
+	var i uint64
+	for ; i < n && !m.Halted(); i++ {
+		fmt.Printf("%6d  SP=%-5d %s\n", m.Steps, m.RAM[vmemu.SP], m.Current())
+		if err := m.Step(); err != nil {
+			return i, err
+		}
+	}
+	return i, nil
+}
+
+func writeScreen(m *vmemu.Machine, fPath string) error {
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, emulator.RenderScreen(m.RAM[emulator.Screen:emulator.Screen+emulator.ScreenSize]))
+}
+
+func readKeyScript(fPath string) (*emulator.KeyScript, error) {
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys, err := emulator.ReadKeyScript(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fPath, err)
+	}
+	return keys, nil
+}
+
+func pickVMFileLocations(fInfos []os.FileInfo, fPath string) (locs []string) {
+	for _, f := range fInfos {
+		name := f.Name()
+		if strings.HasSuffix(name, ".vm") && !f.IsDir() {
+			locs = append(locs, path.Join(fPath, name))
+		}
+	}
+	return locs
+}
+
+func setRAM(m *vmemu.Machine, set string) error {
+	if set == "" {
+		return nil
+	}
+
+	for _, s := range strings.Split(set, ",") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid RAM initialization %q", s)
+		}
+		address, err := strconv.ParseUint(strings.TrimSpace(kv[0]), 10, 15)
+		if err != nil {
+			return fmt.Errorf("invalid RAM address %q", kv[0])
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+		if err != nil || value < -32768 || value > 65535 {
+			return fmt.Errorf("invalid RAM value %q", kv[1])
+		}
+		m.RAM[address] = uint16(value)
+	}
+	return nil
+}
+
+func dumpRAM(m *vmemu.Machine, ranges string) error {
+	if ranges == "" {
+		return nil
+	}
+
+	for _, r := range strings.Split(ranges, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		from, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 15)
+		if err != nil {
+			return fmt.Errorf("invalid RAM range %q", r)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 15); err != nil || to < from {
+				return fmt.Errorf("invalid RAM range %q", r)
+			}
+		}
+
+		for address := from; address <= to; address++ {
+			fmt.Printf("RAM[%d]=%d\n", address, int16(m.RAM[address]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ebakazu/nand2tetris/06/hackasm"
+	"github.com/ebakazu/nand2tetris/08/vm"
+	"github.com/ebakazu/nand2tetris/11/jackc"
+)
+
+// The stages of the toolchain, in the order they run.
+const (
+	stageVM = iota
+	stageAsm
+	stageHack
+)
+
+var stageNames = []string{"vm", "asm", "hack"}
+
+// class is a compiled class of the program or of the OS.
+type class struct {
+	name string
+	code []byte // VM code
+}
+
+func main() {
+	stopName := flag.String("stop", "hack", "last stage to run: vm, asm or hack")
+	keep := flag.Bool("keep", false, "also write the outputs of the stages before the last one")
+	osDir := flag.String("os", "", "directory of OS classes (.jack or .vm) to link with the program; classes the program defines are not linked")
+	shared := flag.Bool("shared", false, "translate calls, returns and comparisons into jumps to shared routines and report the ROM words saved")
+	optimize := flag.Bool("O", false, "fuse common sequences of VM commands into shorter code and report the ROM words saved")
+	prune := flag.Bool("prune", false, "leave out the functions Sys.init never calls and report the ROM words saved")
+	sourceMap := flag.Bool("map", false, "also write the .asm, with the position of each VM command before its code, and a source map to <name>.map.json")
+	outDir := flag.String("o", "", "directory to write the outputs to (default the program directory)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-stop vm|asm|hack] [-keep] [-os directory] [-shared] [-O] [-prune] [-map] [-o directory] file.jack | directory\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	stop := -1
+	for i, name := range stageNames {
+		if name == *stopName {
+			stop = i
+		}
+	}
+	if stop < 0 {
+		log.Fatalf("unknown stage %q", *stopName)
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	fPath := flag.Arg(0)
+
+	fInfo, err := os.Stat(fPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var name, dir string
+	var locs []string
+	if fInfo.IsDir() {
+		fInfos, err := ioutil.ReadDir(fPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name, dir = path.Base(path.Clean(fPath)), fPath
+		locs = pickFileLocations(fInfos, fPath, ".jack")
+	} else {
+		name, dir = strings.TrimSuffix(path.Base(fPath), ".jack"), path.Dir(fPath)
+		locs = []string{fPath}
+	}
+	if len(locs) == 0 {
+		log.Fatalf("no .jack files found")
+	}
+	if *outDir != "" {
+		dir = *outDir
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	classes, err := compileClasses(locs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if stop == stageVM || *keep {
+		for _, c := range classes {
+			if err := os.WriteFile(path.Join(dir, c.name+".vm"), c.code, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if stop == stageVM {
+		return
+	}
+
+	if *osDir != "" {
+		osClasses, err := readOS(*osDir, classes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		classes = append(classes, osClasses...)
+	}
+
+	asmPath := path.Join(dir, name+".asm")
+	opts := vm.Options{Bootstrap: true, SharedRoutines: *shared, Optimize: *optimize, RemoveUnused: *prune}
+	if *sourceMap {
+		opts.SourceMap = &vm.SourceMap{}
+	}
+	asm, size, err := translate(classes, opts)
+	if err != nil {
+		report(err)
+	}
+	if *shared || *optimize || *prune {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", asmPath, size)
+	}
+	if stop == stageAsm || *keep || *sourceMap {
+		if err := os.WriteFile(asmPath, asm, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *sourceMap {
+		m := bytes.NewBuffer([]byte{})
+		if err := opts.SourceMap.WriteJSON(m); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, name+".map.json"), m.Bytes(), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if stop == stageAsm {
+		return
+	}
+
+	words, err := hackasm.NewAssembler(asmPath).Assemble(bytes.NewReader(asm))
+	if err != nil {
+		report(err)
+	}
+	hack := bytes.NewBuffer([]byte{})
+	if err := hackasm.WriteHack(hack, words); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, name+".hack"), hack.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// report prints err to stderr, one line per diagnostic, and exits.
+func report(err error) {
+	switch errs := err.(type) {
+	case hackasm.ErrorList:
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		os.Exit(1)
+	case vm.ErrorList:
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		os.Exit(1)
+	}
+	log.Fatal(err)
+}
+
+func pickFileLocations(fInfos []os.FileInfo, fPath string, ext string) (locs []string) {
+	for _, f := range fInfos {
+		name := f.Name()
+		if strings.HasSuffix(name, ext) && !f.IsDir() {
+			locs = append(locs, path.Join(fPath, name))
+		}
+	}
+	return locs
+}
+
+func className(loc string) string {
+	return strings.TrimSuffix(path.Base(loc), path.Ext(loc))
+}
+
+// compileClasses compiles .jack files into classes.
+func compileClasses(locs []string) ([]class, error) {
+	var classes []class
+	for _, loc := range locs {
+		src, err := os.ReadFile(loc)
+		if err != nil {
+			return nil, err
+		}
+
+		code := bytes.NewBuffer([]byte{})
+		if err := jackc.Compile(code, src); err != nil {
+			return nil, fmt.Errorf("%s: %s", loc, err)
+		}
+		classes = append(classes, class{name: className(loc), code: code.Bytes()})
+	}
+	return classes, nil
+}
+
+// readOS compiles the .jack files of the OS directory and reads its .vm
+// files, skipping the classes the program defines. A class with both a
+// .jack and a .vm file is compiled from its source.
+func readOS(dir string, program []class) ([]class, error) {
+	fInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defined := map[string]bool{}
+	for _, c := range program {
+		defined[c.name] = true
+	}
+
+	var jackLocs []string
+	for _, loc := range pickFileLocations(fInfos, dir, ".jack") {
+		if !defined[className(loc)] {
+			jackLocs = append(jackLocs, loc)
+			defined[className(loc)] = true
+		}
+	}
+	classes, err := compileClasses(jackLocs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, loc := range pickFileLocations(fInfos, dir, ".vm") {
+		if defined[className(loc)] {
+			continue
+		}
+		code, err := os.ReadFile(loc)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class{name: className(loc), code: code})
+	}
+	return classes, nil
+}
+
+// translate translates the classes into one assembly program that starts
+// by calling Sys.init.
+func translate(classes []class, opts vm.Options) ([]byte, vm.SizeReport, error) {
+	files := make([]vm.File, len(classes))
+	for i, c := range classes {
+		files[i] = vm.File{Name: c.name, Src: bytes.NewReader(c.code)}
+	}
+
+	asm := bytes.NewBuffer([]byte{})
+	report, err := vm.Translate(asm, files, opts)
+	if errors.Is(err, vm.ErrNoSysInit) {
+		return nil, vm.SizeReport{}, fmt.Errorf("%s; link the OS with -os", err)
+	}
+	if err != nil {
+		return nil, vm.SizeReport{}, err
+	}
+	return asm.Bytes(), report, nil
+}
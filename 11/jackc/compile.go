@@ -0,0 +1,22 @@
+package jackc
+
+import (
+	"bytes"
+	"io"
+)
+
+// Compile compiles the source of one Jack class into VM code written to out.
+// The tokens go from the tokenizer to the parser in memory, without the
+// T.xml file the compiler command writes.
+func Compile(out io.Writer, src []byte) error {
+	tokens := bytes.NewBuffer([]byte{})
+	if err := NewTokenizer(tokens, src).Tokenize(); err != nil {
+		return err
+	}
+
+	p := NewParser(out)
+	if err := p.ReadTokens(tokens); err != nil {
+		return err
+	}
+	return p.Parse()
+}
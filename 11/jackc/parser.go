@@ -1,4 +1,4 @@
-package main
+package jackc
 
 import (
 	"bufio"
@@ -39,8 +39,14 @@ func (p *Parser) ReadTokenFile(fPath string) error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	s := bufio.NewScanner(f)
+	return p.ReadTokens(f)
+}
+
+// ReadTokens reads the XML token list written by a Tokenizer.
+func (p *Parser) ReadTokens(r io.Reader) error {
+	s := bufio.NewScanner(r)
 
 	for s.Scan() {
 		txt := s.Text()
@@ -72,6 +78,8 @@ func (p *Parser) ReadTokenFile(fPath string) error {
 			p.tokens = append(p.tokens, Token{tokenType: IntConst, value: value})
 
 		case "stringConstant":
+			// keep the spaces and any '<' or '>' of the string itself
+			value = strings.TrimSuffix(strings.TrimPrefix(txt, "<stringConstant> "), " </stringConstant>")
 			p.tokens = append(p.tokens, Token{tokenType: StringConst, value: value})
 		default:
 			return fmt.Errorf("invalid key: %s, text: %s", key1, txt)
@@ -817,6 +825,8 @@ func (p *Parser) doStatement() error {
 	if err := p.subroutineCall(); err != nil {
 		return err
 	}
+	// discard the return value
+	p.vmwriter.WritePop(vmwriter.Temp, 0)
 
 	p.next()
 	if err := p.compileSymbol(";"); err != nil {
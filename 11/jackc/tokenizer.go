@@ -1,4 +1,4 @@
-package main
+package jackc
 
 import (
 	"errors"
@@ -141,6 +141,9 @@ func (t *Tokenizer) Tokenize() error {
 				t.srcIdx++
 				continue
 			}
+
+			// a division
+			t.srcIdx--
 		}
 
 		if c == '"' {
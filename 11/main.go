@@ -6,6 +6,8 @@ import (
 	"os"
 	"path"
 	"strings"
+
+	"github.com/ebakazu/nand2tetris/11/jackc"
 )
 
 func main() {
@@ -71,12 +73,12 @@ func generate(loc string) error {
 		return err
 	}
 
-	t := NewTokenizer(tokenOut, b)
+	t := jackc.NewTokenizer(tokenOut, b)
 	if err := t.Tokenize(); err != nil {
 		return err
 	}
 
-	p := NewParser(codeOut)
+	p := jackc.NewParser(codeOut)
 	if err := p.ReadTokenFile(tokenFileName); err != nil {
 		return err
 	}